@@ -1,15 +1,26 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"runtime/debug"
 	"sort"
-	"text/tabwriter"
+	"strconv"
+	"strings"
+	"text/template"
 )
 
 // CLI is main CLI application definition. It has a name, description, author (which are used only when printing usage syntax), commands and pointers to File instances to which standard output or errors are printed (named respectively stdout and stderr).
@@ -20,17 +31,50 @@ type CLI struct {
 	cmds        map[string]*CLICmd
 	parsedFlags map[string]string
 	parsedArgs  map[string]string
+	parsedVars  map[string][]string
 	stdout      *os.File
 	stderr      *os.File
 	stdin       *os.File
+	cmd         *CLICmd
+	preRun      func(*CLI) error
+	passthrough []string
+	args        []string
+	argFiles    bool
+	version     string
+	noArgs      int
+	noArgsCmd   string
+	printConfig bool
+	interactive bool
+	stdinReader *bufio.Reader
+	pager       bool
+	expEnv      string
+	expFlag     bool
+	parseHook   func(ParseEvent)
+	trimSpace   bool
+	middleware  []Middleware
+	panics      bool
+	configPaths []string
+	flagsFirst  bool
+	helpWidth   int
+	helpTmpl    *template.Template
 }
 
+const (
+	// NoArgsHelp makes CLI print help and exit with 0 when it is run without arguments. It is the default.
+	NoArgsHelp = iota
+	// NoArgsError makes CLI print usage with an error and exit with 2 when it is run without arguments.
+	NoArgsError
+	// NoArgsRunCmd makes CLI run a default command when it is run without arguments.
+	NoArgsRunCmd
+)
+
 // AttachCmd attaches instance of CLICmd to CLI.
 func (c *CLI) AttachCmd(cmd *CLICmd) {
 	n := cmd.name
 	if c.cmds == nil {
 		c.cmds = make(map[string]*CLICmd)
 	}
+	cmd.setPrintConfig(c.printConfig)
 	c.cmds[n] = cmd
 }
 
@@ -50,26 +94,39 @@ func (c *CLI) GetSortedCmds() []string {
 	return scmds
 }
 
+// CompletionCmds returns sorted list of command names that shell completion can offer. Commands hidden from help are included unless they are hidden from completion as well.
+func (c *CLI) CompletionCmds() []string {
+	var ns []string
+	for _, n := range c.GetSortedCmds() {
+		if !c.GetCmd(n).noCompletion {
+			ns = append(ns, n)
+		}
+	}
+	return ns
+}
+
 // PrintHelp prints usage info to stdout file.
 func (c *CLI) PrintHelp() {
-	fmt.Fprintf(c.stdout, c.name+" by "+c.author+"\n"+c.desc+"\n\n")
-	fmt.Fprintf(c.stdout, "Usage: "+path.Base(os.Args[0])+" [FLAGS] COMMAND\n\n")
+	fmt.Fprintf(c.stdout, "%s by %s\n%s\n\n", c.name, c.author, c.desc)
+	fmt.Fprintf(c.stdout, "Usage: %s [FLAGS] COMMAND\n\n", path.Base(os.Args[0]))
 	fmt.Fprintf(c.stdout, "Commands:\n")
 
-	w := new(tabwriter.Writer)
-	w.Init(c.stdout, 8, 8, 0, '\t', 0)
+	var lines []string
 	for _, n := range c.GetSortedCmds() {
 		cmd := c.GetCmd(n)
-		fmt.Fprintf(w, "  %s\t%s\n", n, cmd.desc)
+		if cmd.hidden {
+			continue
+		}
+		lines = append(lines, n+"\t"+cmd.desc)
 	}
-	w.Flush()
+	fmt.Fprintf(c.stdout, "%s", strings.Join(alignColumns(lines, c.helpWidth), ""))
 
-	fmt.Fprintf(c.stdout, "\nRun '"+path.Base(os.Args[0])+" COMMAND --help' for more information on a command.\n")
+	fmt.Fprintf(c.stdout, "\nRun '%[1]s COMMAND --help' or '%[1]s help COMMAND' for more information on a command.\n", path.Base(os.Args[0]))
 }
 
 // PrintInvalidCmd prints invalid command error to stderr file.
 func (c *CLI) PrintInvalidCmd(cmd string) {
-	fmt.Fprintf(c.stderr, "Invalid command: "+cmd+"\n\n")
+	fmt.Fprintf(c.stderr, "Invalid command: %s\n\n", cmd)
 	c.PrintHelp()
 }
 
@@ -80,19 +137,29 @@ func (c *CLI) AddCmd(n string, d string, f func(cli *CLI) int) *CLICmd {
 	return cmd
 }
 
+// AddSeeAlso adds commands refs to the "See also" section of command n help. All the commands must be already added.
+func (c *CLI) AddSeeAlso(n string, refs ...string) {
+	for _, r := range append([]string{n}, refs...) {
+		if c.GetCmd(r) == nil {
+			log.Fatal("Command " + r + " does not exist")
+		}
+	}
+	c.GetCmd(n).seeAlso = append(c.GetCmd(n).seeAlso, refs...)
+}
+
 // AddFlagToCmds adds a flag to all attached commands. It creates CLIFlag instance and attaches it.
-func (c *CLI) AddFlagToCmds(n string, a string, hv string, d string, nf int32, fn func(*CLICmd)) {
-	for _, n := range c.GetSortedCmds() {
-		cmd := c.GetCmd(n)
+func (c *CLI) AddFlagToCmds(n string, a string, hv string, d string, nf int64, fn func(*CLICmd)) {
+	for _, cn := range c.GetSortedCmds() {
+		cmd := c.GetCmd(cn)
 		flg := NewCLIFlag(n, a, hv, d, nf, fn)
 		cmd.AttachFlag(flg)
 	}
 }
 
-// AddArg adds an argument to all attached commands.
-func (c *CLI) AddArgToCmds(n string, hv string, d string, nf int32) {
-	for _, n := range c.GetSortedCmds() {
-		cmd := c.GetCmd(n)
+// AddArgToCmds adds an argument to all attached commands.
+func (c *CLI) AddArgToCmds(n string, hv string, d string, nf int64) {
+	for _, cn := range c.GetSortedCmds() {
+		cmd := c.GetCmd(cn)
 		if cmd.argsIdx > 9 {
 			log.Fatal("Only 10 arguments are allowed")
 		}
@@ -101,28 +168,175 @@ func (c *CLI) AddArgToCmds(n string, hv string, d string, nf int32) {
 	}
 }
 
-// getFlagSetPtrs creates flagset instance, parses flags and returns list of pointers to results of parsing the flags.
-func (c *CLI) getFlagSetPtrs(cmd *CLICmd) (map[string]interface{}, map[string]interface{}, []string) {
+// getFlagSetPtrs creates flagset instance, parses flags and returns list of pointers to results of parsing the flags, keys of flags that were passed and remaining arguments.
+// It returns an error when flags cannot be parsed, eg. undefined flag is passed to a command that does not ignore nor pass through such flags.
+func (c *CLI) getFlagSetPtrs(cmd *CLICmd) (map[string]interface{}, map[string]interface{}, map[string]bool, []string, error) {
 	fset := flag.NewFlagSet("flagset", flag.ContinueOnError)
 	// nothing should come out of flagset
 	fset.Usage = func() {}
 	fset.SetOutput(ioutil.Discard)
 
+	// both maps are keyed with flag key, pointers for missing name or alias are not set
 	nptrs := make(map[string]interface{})
 	aptrs := make(map[string]interface{})
 	fs := cmd.GetSortedFlags()
 	for _, n := range fs {
 		f := cmd.GetFlag(n)
 		if f.IsRequireValue() {
-			nptrs[n] = fset.String(n, "", "")
-			aptrs[f.alias] = fset.String(f.alias, "", "")
+			if f.name != "" {
+				nptrs[n] = fset.String(f.name, "", "")
+			}
+			if f.alias != "" {
+				aptrs[n] = fset.String(f.alias, "", "")
+			}
 		} else if f.nflags&TypeBool > 0 {
-			nptrs[n] = fset.Bool(n, false, "")
-			aptrs[f.alias] = fset.Bool(f.alias, false, "")
+			if f.name != "" {
+				nptrs[n] = fset.Bool(f.name, false, "")
+			}
+			if f.alias != "" {
+				aptrs[n] = fset.Bool(f.alias, false, "")
+			}
+		} else if f.nflags&TypeBoolLoose > 0 {
+			if f.name != "" {
+				nptrs[n] = &looseBool{}
+				fset.Var(nptrs[n].(*looseBool), f.name, "")
+			}
+			if f.alias != "" {
+				aptrs[n] = &looseBool{}
+				fset.Var(aptrs[n].(*looseBool), f.alias, "")
+			}
 		}
 	}
-	fset.Parse(os.Args[2:])
-	return nptrs, aptrs, fset.Args()
+	// flagset values are wrapped to count how many times each flag is passed
+	cmd.counts = make(map[string]int)
+	fset.VisitAll(func(fl *flag.Flag) {
+		cv := &countedValue{Value: fl.Value, key: cmd.flagKey(fl.Name), counts: cmd.counts}
+		if f := cmd.GetFlag(cv.key); f.repeatable() {
+			cv.sep = f.manySeparator()
+		}
+		fl.Value = cv
+	})
+	c.passthrough = nil
+	rest := c.joinLooseBoolValues(cmd, c.args[1:])
+	var positionals []string
+	for {
+		err := fset.Parse(rest)
+		remaining := fset.Args()
+		if err == flag.ErrHelp {
+			positionals = append(positionals, remaining...)
+			break
+		}
+		if err != nil {
+			if !isUndefinedFlagErr(err) || (!cmd.passthrough && !cmd.ignoreUnknown) {
+				return nil, nil, nil, nil, errors.New(strings.ToUpper(err.Error()[:1]) + err.Error()[1:])
+			}
+			// flagset stops after the undefined flag and the remaining arguments are parsed again
+			if cmd.passthrough {
+				u := rest[len(rest)-len(remaining)-1]
+				c.passthrough = append(c.passthrough, u)
+				// value of undefined flag passed without equal sign is the next argument, only when the flag is known to take one
+				if cmd.passthroughTakesValue(u) && len(remaining) > 0 {
+					c.passthrough = append(c.passthrough, remaining[0])
+					remaining = remaining[1:]
+				}
+			}
+			rest = remaining
+			continue
+		}
+		// flagset stops at the first positional argument and, unless flags must come first, flags after it are parsed again
+		parsed := rest[:len(rest)-len(remaining)]
+		if c.flagsFirst || len(remaining) == 0 || isTerminator(cmd, parsed) {
+			positionals = append(positionals, remaining...)
+			break
+		}
+		positionals = append(positionals, remaining[0])
+		rest = remaining[1:]
+	}
+
+	// flagset uses names and aliases so they have to be mapped to flag keys
+	visited := make(map[string]bool)
+	fset.Visit(func(fl *flag.Flag) {
+		visited[cmd.flagKey(fl.Name)] = true
+	})
+	return nptrs, aptrs, visited, positionals, nil
+}
+
+// isTerminator returns true when parsed arguments of command cmd end with -- which is not a value of the preceding flag.
+func isTerminator(cmd *CLICmd, parsed []string) bool {
+	n := len(parsed)
+	return n > 0 && parsed[n-1] == "--" && (n == 1 || !cmd.flagTakesValue(parsed[n-2]))
+}
+
+// countedValue is flag.Value that counts how many times it is set. When sep is set, values are joined with it instead of the last one winning.
+type countedValue struct {
+	flag.Value
+	key    string
+	counts map[string]int
+	sep    string
+}
+
+func (v *countedValue) Set(s string) error {
+	v.counts[v.key]++
+	if v.sep != "" && v.Value.String() != "" {
+		s = v.Value.String() + v.sep + s
+	}
+	return v.Value.Set(s)
+}
+
+func (v *countedValue) IsBoolFlag() bool {
+	b, ok := v.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// isUndefinedFlagErr returns true when err is returned by flagset because of a flag that is not defined.
+func isUndefinedFlagErr(err error) bool {
+	return strings.HasPrefix(err.Error(), "flag provided but not defined")
+}
+
+// joinLooseBoolValues joins TypeBoolLoose flags with their values passed as separate arguments, eg. --feature yes becomes --feature=yes.
+func (c *CLI) joinLooseBoolValues(cmd *CLICmd, args []string) []string {
+	loose := make(map[string]bool)
+	for _, n := range cmd.GetSortedFlags() {
+		f := cmd.GetFlag(n)
+		if f.nflags&TypeBoolLoose > 0 {
+			if f.name != "" {
+				loose[f.name] = true
+			}
+			if f.alias != "" {
+				loose[f.alias] = true
+			}
+		}
+	}
+	if len(loose) == 0 {
+		return args
+	}
+
+	joined := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			joined = append(joined, args[i:]...)
+			break
+		}
+		fn := strings.TrimLeft(a, "-")
+		if fn != a && loose[fn] && i+1 < len(args) {
+			if _, ok := parseLooseBool(args[i+1]); ok {
+				joined = append(joined, a+"="+args[i+1])
+				i++
+				continue
+			}
+		}
+		joined = append(joined, a)
+	}
+	return joined
+}
+
+// printCmdError prints usage line of command cmd and error err to stderr file.
+func (c *CLI) printCmdError(cmd *CLICmd, err error) {
+	c.emit(EventValidationFailed, cmd, nil, "", err)
+	fmt.Fprintln(c.stderr, cmd.Usage())
+	fmt.Fprintf(c.stderr, "ERROR: %s\n", err)
+	fmt.Fprintf(c.stderr, "Run '%s %s --help' for more information.\n", path.Base(os.Args[0]), cmd.name)
 }
 
 // parseFlags iterates over flags and args and validates them. In case of error it prints out to CLI stderr.
@@ -132,39 +346,49 @@ func (c *CLI) parseFlags(cmd *CLICmd) int {
 	}
 
 	fs := cmd.GetSortedFlags()
-	nptrs, aptrs, args := c.getFlagSetPtrs(cmd)
-
+	nptrs, aptrs, visited, args, err := c.getFlagSetPtrs(cmd)
+	if err != nil {
+		c.printCmdError(cmd, err)
+		return 1
+	}
+	cfg, err := c.loadConfig(cmd)
+	if err != nil {
+		c.printCmdError(cmd, err)
+		return 1
+	}
+	cmd.sources = make(map[string]string)
 	for _, n := range fs {
 		f := cmd.GetFlag(n)
-		a := f.alias
-
-		var nv string
-		var av string
-		if f.nflags&TypeBool > 0 {
-			c.parsedFlags[n] = "false"
-			if *(nptrs[n]).(*bool) == true || *(aptrs[a]).(*bool) == true {
-				c.parsedFlags[n] = "true"
-				if f.fn != nil {
-					f.fn(cmd)
-				}
-			}
-			continue
-		}
-
-		nv = *(nptrs[n]).(*string)
-		av = *(aptrs[a]).(*string)
-
-		err := f.ValidateValue(false, nv, av)
+		v, err := c.parseFlag(cmd, n, nptrs[n], aptrs[n], visited[n], cfg, true)
 		if err != nil {
-			fmt.Fprintf(c.stderr, "ERROR: "+err.Error()+"\n")
-			cmd.PrintHelp(c)
+			c.printCmdError(cmd, err)
 			return 1
 		}
+		c.parsedFlags[n] = v
+		if f.nflags&(TypeBool|TypeBoolLoose) > 0 && v == "true" && f.fn != nil && !c.recovered("Callback of flag "+f.label(), func() { f.fn(cmd) }) {
+			return 1
+		}
+	}
 
-		c.parsedFlags[n] = av
-		if nv != "" {
-			c.parsedFlags[n] = nv
+	err = cmd.validateRelations(c.parsedFlags)
+	if err != nil {
+		c.printCmdError(cmd, err)
+		return 1
+	}
+
+	// defaults are evaluated when all the passed flags are known
+	for _, n := range cmd.defaultsOrder() {
+		f := cmd.GetFlag(n)
+		if c.parsedFlags[n] != "" {
+			continue
 		}
+		v := f.defFn(c)
+		if err := f.ValidateValue(false, v, ""); err != nil {
+			c.printCmdError(cmd, err)
+			return 1
+		}
+		c.parsedFlags[n], _ = f.normalize(v)
+		cmd.sources[n] = "default"
 	}
 
 	if c.parsedArgs == nil {
@@ -178,61 +402,506 @@ func (c *CLI) parseFlags(cmd *CLICmd) int {
 		if len(args) >= i+1 {
 			v = args[i]
 		}
+		var err error
+		if c.parsedArgs[n], err = c.parseArg(cmd.GetArg(n), v, len(args) > i); err != nil {
+			c.printCmdError(cmd, err)
+			return 1
+		}
+	}
+
+	if c.parsedVars == nil {
+		c.parsedVars = make(map[string][]string)
+	}
+
+	if cmd.variadic == nil && !cmd.extraArgs && len(args) > len(as) {
+		c.printCmdError(cmd, errors.New("Unexpected argument "+args[len(as)]))
+		return 1
+	}
 
-		f := cmd.GetArg(n)
+	if f := cmd.GetVariadicArg(); f != nil {
+		var vs []string
+		if len(args) > len(as) {
+			vs = make([]string, len(args)-len(as))
+			for i, v := range args[len(as):] {
+				vs[i] = c.trimValue(f, v)
+			}
+		}
 
-		err := f.ValidateValue(true, v, "")
+		var err error
+		if len(vs) < cmd.variadicMin {
+			err = errors.New(fmt.Sprintf("Argument %s requires at least %d values", f.helpValue, cmd.variadicMin))
+		} else if cmd.variadicMax > 0 && len(vs) > cmd.variadicMax {
+			err = errors.New(fmt.Sprintf("Argument %s allows at most %d values", f.helpValue, cmd.variadicMax))
+		}
+		for i := 0; err == nil && i < len(vs); i++ {
+			err = f.ValidateValue(true, vs[i], "")
+		}
 		if err != nil {
-			fmt.Fprintf(c.stderr, "ERROR: "+err.Error()+"\n")
-			cmd.PrintHelp(c)
+			c.printCmdError(cmd, err)
 			return 1
 		}
 
-		c.parsedArgs[n] = v
+		nvs := make([]string, len(vs))
+		for i, v := range vs {
+			nvs[i], _ = f.normalize(v)
+		}
+		c.parsedVars[f.name] = nvs
 	}
 
 	postv := cmd.GetPostValidation()
 	if postv != nil {
 		err := postv(c)
 		if err != nil {
-			fmt.Fprintf(c.stderr, "ERROR: "+err.Error()+"\n")
-			cmd.PrintHelp(c)
+			c.printCmdError(cmd, err)
 			return 1
 		}
 	}
 	return 0
 }
 
+// AddPreRun attaches a function that is executed before handler of any command. It runs after flags are parsed and validated, and before pre-run function of the command. When it returns an error the command is not executed.
+func (c *CLI) AddPreRun(fn func(*CLI) error) {
+	c.preRun = fn
+}
+
+// GetPreRun returns pre-run function
+func (c *CLI) GetPreRun() (fn func(*CLI) error) {
+	return c.preRun
+}
+
+// parseFlag resolves value of flag n of command cmd from pointers np and ap of flagset, environment, secret file or cfg read from config files, and validates it like Run does.
+// It returns value of the flag, normalized unless flag is TypeBool. User is asked for missing value of Required flag only when prompt is true. Callback of the flag is not run.
+func (c *CLI) parseFlag(cmd *CLICmd, n string, np interface{}, ap interface{}, visited bool, cfg map[string]string, prompt bool) (string, error) {
+	f := cmd.GetFlag(n)
+	nv, av, src, err := c.resolveFlag(f, np, ap, visited)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := cfg[n]; ok && src == "" {
+		nv, av, src = v, "", "config"
+	}
+	cmd.sources[n] = src
+	if cmd.Count(n) > 1 && f.nflags&AllowDuplicate == 0 && !f.repeatable() {
+		// flag passed with both alias and name is counted twice, but it is a conflict rather than a duplicate
+		if passedBoth(np, ap) {
+			return "", f.conflictError(nv + av)
+		}
+		return "", f.fail("duplicate", "single value", nv+av, "Flag "+f.label()+" specified more than once")
+	}
+	if f.depr && src != "" && f.isSet(nv+av) {
+		fmt.Fprintf(c.stderr, "WARNING: %s\n", f.deprecationWarning())
+	}
+	if src == "flag" {
+		c.emit(EventFlagSeen, cmd, f, nv+av, nil)
+	}
+	if f.nflags&Experimental > 0 && src != "" && !c.experimentalEnabled() {
+		return "", errors.New("Flag " + f.label() + " is experimental and it requires --experimental" + c.experimentalEnvHint())
+	}
+	if f.nflags&TypeBool > 0 {
+		c.emit(EventFlagValidated, cmd, f, nv, nil)
+		return nv, nil
+	}
+
+	if f.nflags&Required > 0 && nv == "" && av == "" && prompt && c.canPrompt() {
+		if nv, err = c.prompt(f); err != nil {
+			return "", err
+		}
+		cmd.sources[n] = "prompt"
+	}
+	nv, av = c.trimValue(f, nv), c.trimValue(f, av)
+
+	err = f.ValidateValue(false, nv, av)
+	// empty value cannot be told apart from missing one by ValidateValue
+	if err == nil && f.nflags&TypeNonEmpty > 0 && visited && nv+av == "" {
+		err = f.blankError(false, "")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	v := av
+	if nv != "" {
+		v = nv
+	}
+	v, _ = f.normalize(v)
+	c.emit(EventFlagValidated, cmd, f, v, nil)
+	return v, nil
+}
+
+// passedBoth returns true when flagset set values of both name and alias pointers np and ap.
+func passedBoth(np interface{}, ap interface{}) bool {
+	set := func(p interface{}) bool {
+		switch v := p.(type) {
+		case *bool:
+			return *v
+		case *string:
+			return *v != ""
+		case *looseBool:
+			return v.v != ""
+		}
+		return false
+	}
+	return set(np) && set(ap)
+}
+
+// parseArg trims and validates value v of argument f, and returns it normalized. When passed is true, argument was present even if v is empty.
+func (c *CLI) parseArg(f *CLIFlag, v string, passed bool) (string, error) {
+	v = c.trimValue(f, v)
+	err := f.ValidateValue(true, v, "")
+	if err == nil && f.nflags&TypeNonEmpty > 0 && passed && v == "" {
+		err = f.blankError(true, "")
+	}
+	if err != nil {
+		return "", err
+	}
+	v, _ = f.normalize(v)
+	return v, nil
+}
+
+// resolveFlag returns values of flag f passed with name and alias, read from pointers np and ap of flagset, and where they come from: "flag", "env", "secret-file" or empty string when flag is not set.
+// Value is taken from environment variable when flag was not visited by flagset. Bool flag has its value returned as the first one and it is either "true" or "false".
+func (c *CLI) resolveFlag(f *CLIFlag, np interface{}, ap interface{}, visited bool) (string, string, string, error) {
+	src := ""
+	if visited {
+		src = "flag"
+	}
+	if f.nflags&TypeBool > 0 {
+		nb, _ := np.(*bool)
+		ab, _ := ap.(*bool)
+		if (nb != nil && *nb) || (ab != nil && *ab) {
+			return "true", "", src, nil
+		}
+		if !visited && f.env != "" && os.Getenv(f.env) != "" {
+			b, ok := parseLooseBool(os.Getenv(f.env))
+			if !ok {
+				return "", "", "env", errors.New("Environment variable " + f.env + " of flag " + f.key() + " has invalid boolean value")
+			}
+			return strconv.FormatBool(b), "", "env", nil
+		}
+		return "false", "", src, nil
+	}
+
+	var nv, av string
+	if p, ok := np.(*string); ok {
+		nv = *p
+	} else if p, ok := np.(*looseBool); ok {
+		nv = p.v
+	}
+	if p, ok := ap.(*string); ok {
+		av = *p
+	} else if p, ok := ap.(*looseBool); ok {
+		av = p.v
+	}
+	if !visited && f.env != "" {
+		nv = os.Getenv(f.env)
+		if nv != "" {
+			src = "env"
+		}
+	}
+	if src == "" && f.secFile != "" {
+		dat, err := os.ReadFile(f.secFile)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", "", "secret-file", errors.New("Secret file " + f.secFile + " of flag " + f.key() + " cannot be read")
+		}
+		if err == nil {
+			nv, src = strings.TrimRight(string(dat), "\r\n"), "secret-file"
+		}
+	}
+	if f.nflags&TypeText > 0 {
+		var err error
+		if nv, err = c.readText(f, nv); err == nil {
+			av, err = c.readText(f, av)
+		}
+		if err != nil {
+			return "", "", src, err
+		}
+	}
+	return nv, av, src, nil
+}
+
+// readText returns value v of TypeText flag f. Value is read from a file when it starts with @ and from stdin when it is -.
+func (c *CLI) readText(f *CLIFlag, v string) (string, error) {
+	if v == "-" {
+		b, err := io.ReadAll(c.getStdin())
+		if err != nil {
+			return "", errors.New("Flag " + f.key() + " cannot be read from stdin")
+		}
+		return string(b), nil
+	}
+	if strings.HasPrefix(v, "@@") {
+		return v[1:], nil
+	}
+	if strings.HasPrefix(v, "@") {
+		b, err := os.ReadFile(v[1:])
+		if err != nil {
+			return "", errors.New("File " + v[1:] + " from " + f.key() + " cannot be read")
+		}
+		return string(b), nil
+	}
+	return v, nil
+}
+
+// SetArgFiles sets whether arguments starting with @ are replaced with arguments read from the file, eg. @args.txt. Arguments in the file are separated with whitespace and can be quoted. Argument files can include other argument files.
+// Argument that is a value of the preceding flag, eg. --message @msg.txt, is not treated as an argument file.
+func (c *CLI) SetArgFiles(b bool) {
+	c.argFiles = b
+}
+
+// SetFlagsFirst sets whether flags must come before positional arguments, like in POSIX. By default flags and positional arguments can be mixed, eg. file1 --verbose file2, and all the arguments after -- are positional.
+func (c *CLI) SetFlagsFirst(b bool) {
+	c.flagsFirst = b
+}
+
+// SetTrimSpace sets whether leading and trailing whitespace is removed from values of flags and arguments before they are validated. Flag can override it with TrimSpace or NoTrimSpace.
+func (c *CLI) SetTrimSpace(b bool) {
+	c.trimSpace = b
+}
+
+// trimValue returns value v of flag f with leading and trailing whitespace removed when trimming applies to the flag.
+func (c *CLI) trimValue(f *CLIFlag, v string) string {
+	if f.nflags&TrimSpace > 0 || (c.trimSpace && f.nflags&NoTrimSpace == 0) {
+		return strings.TrimSpace(v)
+	}
+	return v
+}
+
+// SetNoArgs sets what happens when CLI is run without arguments: NoArgsHelp, NoArgsError or NoArgsRunCmd. Command n is run with NoArgsRunCmd and it must be already added.
+func (c *CLI) SetNoArgs(b int, n string) {
+	if b == NoArgsRunCmd && c.GetCmd(n) == nil {
+		log.Fatal("Command " + n + " does not exist")
+	}
+	c.noArgs = b
+	c.noArgsCmd = n
+}
+
+// SetPrintConfig enables --print-config flag in all commands, so commands cannot have a flag of that name. When it is passed, values of flags and arguments are validated and printed as JSON instead of running the command. Values of Secret flags, and defaults derived from them, are redacted.
+func (c *CLI) SetPrintConfig(b bool) {
+	c.printConfig = b
+	for _, cmd := range c.cmds {
+		cmd.setPrintConfig(b)
+	}
+}
+
+// removePrintConfigArg removes --print-config from command arguments and returns true if it was there.
+func (c *CLI) removePrintConfigArg() bool {
+	for i, a := range c.args[1:] {
+		if a == "--" {
+			return false
+		}
+		// value of the preceding flag is not --print-config
+		if a == "--print-config" && (i == 0 || !c.cmd.flagTakesValue(c.args[i])) {
+			// args share backing array with os.Args so a new slice is built
+			c.args = append(append([]string{}, c.args[:i+1]...), c.args[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// printEffectiveConfig prints values of flags and arguments of the running command as JSON to stdout file.
+func (c *CLI) printEffectiveConfig() int {
+	cfg := map[string]map[string]interface{}{
+		"flags": {},
+		"args":  {},
+	}
+	redacted := c.cmd.redactedFlags()
+	for _, n := range c.cmd.GetSortedFlags() {
+		v := c.parsedFlags[n]
+		if redacted[n] && v != "" {
+			v = "********"
+		}
+		cfg["flags"][n] = v
+	}
+	for _, n := range c.cmd.GetSortedArgs() {
+		cfg["args"][n] = c.parsedArgs[n]
+	}
+	if c.cmd.variadic != nil {
+		cfg["args"][c.cmd.variadic.name] = c.parsedVars[c.cmd.variadic.name]
+	}
+	dat, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		fmt.Fprintf(c.stderr, "ERROR: %s\n", err)
+		return 1
+	}
+	fmt.Fprintf(c.stdout, "%s\n", dat)
+	return 0
+}
+
+// SetExperimentalEnv sets environment variable that enables Experimental flags when it is true, in addition to --experimental passed before the command.
+func (c *CLI) SetExperimentalEnv(e string) {
+	c.expEnv = e
+}
+
+// experimentalEnvHint returns hint about environment variable enabling Experimental flags.
+func (c *CLI) experimentalEnvHint() string {
+	if c.expEnv == "" {
+		return ""
+	}
+	return " or " + c.expEnv + "=1"
+}
+
+// experimentalEnabled returns true when Experimental flags can be used.
+func (c *CLI) experimentalEnabled() bool {
+	if c.expFlag {
+		return true
+	}
+	if c.expEnv == "" {
+		return false
+	}
+	b, _ := parseLooseBool(os.Getenv(c.expEnv))
+	return b
+}
+
+// SetVersion sets version that is printed with --version.
+func (c *CLI) SetVersion(v string) {
+	c.version = v
+}
+
+// Version returns version set with SetVersion. When it is not set, version of the main module and VCS revision are taken from the build info. It returns "unknown" when there is none.
+func (c *CLI) Version() string {
+	if c.version != "" {
+		return c.version
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	v := bi.Main.Version
+	if v == "(devel)" {
+		v = ""
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" && s.Value != "" {
+			r := s.Value
+			if len(r) > 12 {
+				r = r[:12]
+			}
+			if v == "" {
+				v = r
+			} else {
+				v += " (" + r + ")"
+			}
+		}
+	}
+	if v == "" {
+		return "unknown"
+	}
+	return v
+}
+
+// Reset clears values of flags and arguments parsed in the last run, together with state of parsing of all the commands, so the same CLI can be run again with other arguments. Configuration is kept.
+// CLI should not be run nor reset concurrently.
+func (c *CLI) Reset() {
+	c.parsedFlags = nil
+	c.parsedArgs = nil
+	c.parsedVars = nil
+	c.passthrough = nil
+	c.cmd = nil
+	for _, cmd := range c.cmds {
+		cmd.Reset()
+	}
+}
+
 // SetStdin sets stdin
 func (c *CLI) SetStdin(stdin *os.File) {
 	c.stdin = stdin
+	c.stdinReader = nil
 }
 
 // Run parses the arguments, validates them and executes command handler. In case of invalid arguments, error is printed to stderr and 1 is returned. Return value behaves like exit code.
 func (c *CLI) Run(stdout *os.File, stderr *os.File) int {
 	c.stdout = stdout
 	c.stderr = stderr
+	c.args = os.Args[1:]
+	if c.argFiles {
+		args, err := expandLeadingArgFiles(c.args)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "ERROR: %s\n", err)
+			return 1
+		}
+		c.args = args
+	}
+	c.expFlag = len(c.args) > 0 && c.args[0] == "--experimental"
+	if c.expFlag {
+		c.args = c.args[1:]
+	}
+	if len(c.args) < 1 {
+		switch c.noArgs {
+		case NoArgsError:
+			fmt.Fprintf(c.stderr, "Usage: %s [FLAGS] COMMAND\n", path.Base(os.Args[0]))
+			fmt.Fprintf(c.stderr, "ERROR: Command is missing\n")
+			return 2
+		case NoArgsRunCmd:
+			c.args = []string{c.noArgsCmd}
+		}
+	}
 	// display help
-	if len(os.Args[1:]) < 1 || (len(os.Args[1:]) == 1 && (os.Args[1] == "-h" || os.Args[1] == "--help")) {
-		c.PrintHelp()
+	if len(c.args) < 1 || (len(c.args) == 1 && (c.args[0] == "-h" || c.args[0] == "--help")) {
+		c.page(c.PrintHelp)
+		return 0
+	}
+	// display version
+	if len(c.args) == 1 && c.args[0] == "--version" {
+		fmt.Fprintf(c.stdout, "%s %s\n", c.name, c.Version())
+		return 0
+	}
+	// display help of a command when there is no command named help
+	if c.args[0] == "help" && c.GetCmd("help") == nil && len(c.args) < 3 {
+		if len(c.args) == 1 {
+			c.page(c.PrintHelp)
+			return 0
+		}
+		if c.GetCmd(c.args[1]) == nil {
+			c.PrintInvalidCmd(c.args[1])
+			return 1
+		}
+		c.page(func() { c.GetCmd(c.args[1]).PrintHelp(c) })
 		return 0
 	}
 	for _, n := range c.GetSortedCmds() {
-		if n == os.Args[1] {
-			// display command help
-			if len(os.Args[1:]) == 2 && (os.Args[2] == "-h" || os.Args[2] == "--help") {
-				c.GetCmd(n).PrintHelp(c)
+		if n == c.args[0] {
+			if err := c.GetCmd(n).checkConfig(); err != nil {
+				fmt.Fprintf(c.stderr, "ERROR: %s\n", err)
+				return 1
+			}
+			if c.argFiles {
+				args, err := expandArgFiles(c.GetCmd(n), c.args[1:], 0)
+				if err != nil {
+					fmt.Fprintf(c.stderr, "ERROR: %s\n", err)
+					return 1
+				}
+				c.args = append([]string{n}, args...)
+			}
+			// display command help, even when other arguments are invalid
+			if c.GetCmd(n).helpRequested(c.args[1:]) {
+				c.page(func() { c.GetCmd(n).PrintHelp(c) })
 				return 0
 			}
-			exitCode := c.parseFlags(c.GetCmd(n))
+			c.cmd = c.GetCmd(n)
+			printCfg := c.printConfig && c.removePrintConfigArg()
+			exitCode := c.parseFlags(c.cmd)
 			if exitCode > 0 {
 				return exitCode
 			}
-			return c.GetCmd(n).Run(c)
+			if printCfg {
+				return c.printEffectiveConfig()
+			}
+			for _, prer := range []func(*CLI) error{c.GetPreRun(), c.cmd.GetPreRun()} {
+				if prer == nil {
+					continue
+				}
+				err := prer(c)
+				if err != nil {
+					fmt.Fprintf(c.stderr, "ERROR: %s\n", err)
+					return 1
+				}
+			}
+			c.emit(EventCmdDispatched, c.cmd, nil, "", nil)
+			return c.wrapHandler(c.cmd)(c)
 		}
 	}
 	// command not found
-	c.PrintInvalidCmd(os.Args[1])
+	c.PrintInvalidCmd(c.args[0])
 	return 1
 }
 
@@ -241,11 +910,148 @@ func (c *CLI) Flag(n string) string {
 	return c.parsedFlags[n]
 }
 
+// FlagInt returns value of TypeInt flag as int64. For flags with AllowBasePrefix the value is parsed with its base. It returns 0 when flag is empty or has many values.
+func (c *CLI) FlagInt(n string) int64 {
+	if c.cmd == nil || c.cmd.GetFlag(n) == nil {
+		return 0
+	}
+	i, err := c.cmd.GetFlag(n).parseInt(c.parsedFlags[n])
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+// FlagByteSize returns value of TypeByteSize flag as number of bytes. It returns 0 when flag is empty or has many values.
+func (c *CLI) FlagByteSize(n string) int64 {
+	b, err := parseByteSize(c.parsedFlags[n])
+	if err != nil {
+		return 0
+	}
+	return b
+}
+
+// FlagRate returns value of TypeRate flag as number of bytes per second. It returns 0 when flag is empty or has many values.
+func (c *CLI) FlagRate(n string) int64 {
+	r, err := parseRate(c.parsedFlags[n])
+	if err != nil {
+		return 0
+	}
+	return r
+}
+
+// FlagMap returns value of TypeKeyValue flag as map. It returns nil when flag is empty.
+func (c *CLI) FlagMap(n string) map[string]string {
+	if c.cmd == nil || c.cmd.GetFlag(n) == nil || c.parsedFlags[n] == "" {
+		return nil
+	}
+	kvs, err := c.cmd.GetFlag(n).keyValues(c.parsedFlags[n])
+	if err != nil {
+		return nil
+	}
+	return kvs
+}
+
+// FlagIntMap returns value of TypeKeyValue flag with TypeInt values as map of integers. Values that are not integers are skipped.
+func (c *CLI) FlagIntMap(n string) map[string]int64 {
+	kvs := c.FlagMap(n)
+	if kvs == nil {
+		return nil
+	}
+	vf := &CLIFlag{nflags: c.cmd.GetFlag(n).kvType}
+	m := make(map[string]int64)
+	for k, v := range kvs {
+		if i, err := vf.parseInt(v); err == nil {
+			m[k] = i
+		}
+	}
+	return m
+}
+
+// FlagJSON unmarshals JSON of ValidJSON flag into v. For TypePathRegularFile flag, contents of the file that was read during validation is used.
+func (c *CLI) FlagJSON(n string, v interface{}) error {
+	if c.cmd == nil || c.cmd.GetFlag(n) == nil || c.cmd.GetFlag(n).nflags&ValidJSON == 0 {
+		return errors.New("Flag " + n + " is not a JSON flag")
+	}
+	if c.parsedFlags[n] == "" {
+		return errors.New("Flag " + n + " is empty")
+	}
+	dat, err := c.cmd.GetFlag(n).jsonData(c.parsedFlags[n])
+	if err != nil {
+		return errors.New("File " + c.parsedFlags[n] + " from " + n + " cannot be read")
+	}
+	return json.Unmarshal(dat, v)
+}
+
+// FlagDotEnv returns variables from dotenv file of DotEnv flag as map. Contents of the file that was read during validation is used. It returns nil when flag is empty.
+func (c *CLI) FlagDotEnv(n string) map[string]string {
+	if c.cmd == nil || c.cmd.GetFlag(n) == nil || c.cmd.GetFlag(n).nflags&DotEnv == 0 || c.parsedFlags[n] == "" {
+		return nil
+	}
+	dat, err := c.cmd.GetFlag(n).fileData(c.parsedFlags[n])
+	if err != nil {
+		return nil
+	}
+	env, err := parseDotEnv(dat)
+	if err != nil {
+		return nil
+	}
+	return env
+}
+
+// FlagGlob returns files matching pattern of ExpandGlob flag, the same ones that were validated. It returns nil when flag is empty or nothing matches.
+func (c *CLI) FlagGlob(n string) []string {
+	if c.cmd == nil || c.cmd.GetFlag(n) == nil || c.cmd.GetFlag(n).nflags&ExpandGlob == 0 || c.parsedFlags[n] == "" {
+		return nil
+	}
+	g := c.cmd.GetFlag(n).glob
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.pattern == c.parsedFlags[n] {
+		return append([]string(nil), g.matches...)
+	}
+	matches, _ := filepath.Glob(c.parsedFlags[n])
+	return matches
+}
+
+// FlagRegexpReplacement returns compiled pattern and replacement of TypeRegexpReplacement flag. It returns nil pattern when flag is empty.
+func (c *CLI) FlagRegexpReplacement(n string) (*regexp.Regexp, string) {
+	re, repl, err := parseRegexpReplacement(c.parsedFlags[n])
+	if err != nil {
+		return nil, ""
+	}
+	return re, repl
+}
+
+// FlagHeaders returns headers of TypeHTTPHeader flag. It returns nil when flag is empty.
+func (c *CLI) FlagHeaders(n string) http.Header {
+	if c.cmd == nil || c.cmd.GetFlag(n) == nil || c.parsedFlags[n] == "" {
+		return nil
+	}
+	hs := make(http.Header)
+	for _, l := range c.cmd.GetFlag(n).values(c.parsedFlags[n]) {
+		if k, v, ok := parseHTTPHeader(l); ok {
+			hs.Add(k, v)
+		}
+	}
+	return hs
+}
+
+// Passthrough returns flags that are not defined in the command when it has passthrough set.
+func (c *CLI) Passthrough() []string {
+	return c.passthrough
+}
+
 // Arg returns value of arg.
 func (c *CLI) Arg(n string) string {
 	return c.parsedArgs[n]
 }
 
+// VariadicArg returns values of variadic arg.
+func (c *CLI) VariadicArg(n string) []string {
+	return c.parsedVars[n]
+}
+
 // NewCLI creates new instance of CLI with name n, description d and author a and returns it.
 func NewCLI(n string, d string, a string) *CLI {
 	c := &CLI{name: n, desc: d, author: a}
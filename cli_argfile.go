@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// maxArgFileDepth is how deep argument files can include other argument files.
+const maxArgFileDepth = 10
+
+// isArgFile returns true when argument a points to an argument file, eg. @args.txt.
+func isArgFile(a string) bool {
+	return len(a) > 1 && a[0] == '@'
+}
+
+// readArgFile reads argument file at path p and splits its contents into arguments.
+func readArgFile(p string) ([]string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, errors.New("Argument file " + p + " cannot be read")
+	}
+	args, err := splitArgs(string(b))
+	if err != nil {
+		return nil, errors.New("Argument file " + p + " " + err.Error())
+	}
+	return args, nil
+}
+
+// splitArgs splits s into arguments separated by whitespace. Arguments can be quoted with single or double quotes and outside of single quotes backslash escapes the next character.
+// Unquoted # that starts an argument begins a comment which lasts until the end of line.
+func splitArgs(s string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	comment := false
+	for _, r := range s {
+		switch {
+		case comment:
+			comment = r != '\n'
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '#' && !inArg:
+			comment = true
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("has unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// expandLeadingArgFiles replaces argument files at the beginning of args with their contents so that the command name can come from a file.
+func expandLeadingArgFiles(args []string) ([]string, error) {
+	for i := 0; len(args) > 0 && isArgFile(args[0]); i++ {
+		if i >= maxArgFileDepth {
+			return nil, errors.New("Argument files are nested too deeply")
+		}
+		fargs, err := readArgFile(args[0][1:])
+		if err != nil {
+			return nil, err
+		}
+		args = append(fargs, args[1:]...)
+	}
+	return args, nil
+}
+
+// expandArgFiles replaces argument files in args of command cmd with their contents. Argument that is a value of the preceding flag, eg. --message @file, and arguments after -- are not expanded.
+func expandArgFiles(cmd *CLICmd, args []string, depth int) ([]string, error) {
+	if depth >= maxArgFileDepth {
+		return nil, errors.New("Argument files are nested too deeply")
+	}
+	var expanded []string
+	for i, a := range args {
+		if a == "--" {
+			expanded = append(expanded, args[i:]...)
+			break
+		}
+		if isArgFile(a) && (len(expanded) == 0 || !cmd.flagTakesValue(expanded[len(expanded)-1])) {
+			fargs, err := readArgFile(a[1:])
+			if err != nil {
+				return nil, err
+			}
+			fargs, err = expandArgFiles(cmd, fargs, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, fargs...)
+			continue
+		}
+		expanded = append(expanded, a)
+	}
+	return expanded, nil
+}
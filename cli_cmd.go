@@ -1,13 +1,15 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path"
 	"reflect"
 	"sort"
-	"text/tabwriter"
+	"strings"
+	"text/template"
 )
 
 // CLICmd represent a command which has a name (used in args when calling app), description, a handler and flags attached to it.
@@ -20,6 +22,36 @@ type CLICmd struct {
 	argsIdx        int
 	handler        func(c *CLI) int
 	postValidation func(*CLI) error
+	preRun         func(*CLI) error
+	passthrough    bool
+	passValues     []string
+	ignoreUnknown  bool
+	extraArgs      bool
+	variadic       *CLIFlag
+	variadicMin    int
+	variadicMax    int
+	requires       map[string][]string
+	exclusive      [][]string
+	exactlyOne     [][]string
+	counts         map[string]int
+	hidden         bool
+	noCompletion   bool
+	seeAlso        []string
+	sources        map[string]string
+	helpTmpl       *template.Template
+	printConfig    bool
+}
+
+// FlagReport describes flag of a command resolved and validated by Report.
+type FlagReport struct {
+	// Name is a key of the flag.
+	Name string
+	// Value is the resolved value. It is redacted for Secret flags and for flags which default is derived from a Secret flag.
+	Value string
+	// Source is where the value comes from: "flag", "env", "secret-file", "config", "default" or empty string when flag is not set.
+	Source string
+	// Err is nil when value is valid.
+	Err *ValidationError
 }
 
 // GetSortedArgs returns arguments list of arg names sorted how they were added but required ones are first.
@@ -59,51 +91,296 @@ func (c *CLICmd) getArgsHelpLine() string {
 			}
 		}
 	}
+	if c.variadic != nil {
+		if c.variadicMin > 0 {
+			sr += " " + c.variadic.helpValue + "..."
+		} else {
+			sr += " [" + c.variadic.helpValue + "...]"
+		}
+	}
 	return sr + so
 }
 
-// PrintHelp prints command usage information to stdout file.
+// Usage returns one-line synopsis of the command. Required flags are listed first, followed by optional ones in brackets and arguments. Experimental flags are not listed.
+func (c *CLICmd) Usage() string {
+	var sr, so string
+	for _, n := range c.GetSortedFlags() {
+		f := c.GetFlag(n)
+		if f.nflags&Experimental > 0 {
+			continue
+		}
+		l := f.label()
+		if f.IsRequireValue() {
+			l += " " + f.valuePlaceholder()
+		}
+		if f.nflags&Required > 0 {
+			sr += " " + l
+		} else {
+			so += " [" + l + "]"
+		}
+	}
+	return fmt.Sprintf("Usage:  %s %s", path.Base(os.Args[0]), c.name) + sr + so + c.getArgsHelpLine()
+}
+
+// PrintHelp prints command usage information to stdout file. It is rendered with help template of the command or the CLI when one is set.
 func (c *CLICmd) PrintHelp(cli *CLI) {
-	fmt.Fprintf(cli.stdout, fmt.Sprintf("\nUsage:  %s %s [FLAGS]%s\n\n", path.Base(os.Args[0]), c.name, c.getArgsHelpLine()))
-	fmt.Fprintf(cli.stdout, fmt.Sprintf("%s\n", c.desc))
+	d := c.helpData(cli)
+	if t := c.helpTemplate(cli); t != nil {
+		if err := t.Execute(cli.stdout, d); err != nil {
+			fmt.Fprintf(cli.stderr, "ERROR: Help of command %s cannot be printed: %s\n", c.name, err.Error())
+		}
+		return
+	}
+	fmt.Fprintf(cli.stdout, "\n%s\n\n", d.Usage)
+	fmt.Fprintf(cli.stdout, "%s\n", d.Description)
+
+	for _, sec := range []struct {
+		title string
+		flags []HelpFlag
+	}{{"Required", d.RequiredFlags}, {"Optional", d.OptionalFlags}} {
+		if len(sec.flags) == 0 {
+			continue
+		}
+		fmt.Fprintf(cli.stdout, "\n%s flags: \n", sec.title)
+		for _, f := range sec.flags {
+			fmt.Fprintf(cli.stdout, "%s\n", f.Line)
+		}
+	}
+	if len(d.SeeAlso) > 0 {
+		fmt.Fprintf(cli.stdout, "\nSee also: %s\n", strings.Join(d.SeeAlso, ", "))
+	}
 
-	w := new(tabwriter.Writer)
-	w.Init(cli.stdout, 8, 8, 0, '\t', 0)
+}
 
-	var s [2]string
-	i := 1
-	for _, n := range c.GetSortedFlags() {
-		flag := c.GetFlag(n)
-		if flag.nflags&Required > 0 {
-			i = 0
-		} else {
-			i = 1
+// annotateHelpLine adds relationships of flag n with other flags to its help line l.
+func (c *CLICmd) annotateHelpLine(n string, l string) string {
+	var notes []string
+	if rs := c.flagRequires(n); len(rs) > 0 {
+		notes = append(notes, "requires "+c.flagLabels(rs))
+	}
+	for _, g := range c.exclusive {
+		var others []string
+		for _, o := range g {
+			if o != n {
+				others = append(others, o)
+			}
+		}
+		if len(others) < len(g) {
+			notes = append(notes, "cannot be used with "+c.flagLabels(others))
+		}
+	}
+	for _, g := range c.exactlyOne {
+		for _, o := range g {
+			if o == n {
+				notes = append(notes, "exactly one of "+c.flagLabels(g))
+				break
+			}
 		}
-		s[i] += flag.GetHelpLine()
 	}
+	if len(notes) == 0 {
+		return l
+	}
+	return strings.TrimSuffix(l, "\n") + " (" + strings.Join(notes, "; ") + ")\n"
+}
+
+// flagLabels returns comma-separated list of flags ns as they are passed, eg. --name or -n.
+func (c *CLICmd) flagLabels(ns []string) string {
+	ls := make([]string, len(ns))
+	for i, n := range ns {
+		ls[i] = c.GetFlag(n).label()
+	}
+	return strings.Join(ls, ", ")
+}
 
-	if s[0] != "" {
-		fmt.Fprintf(w, "\nRequired flags: \n")
-		fmt.Fprintf(w, s[0])
-		w.Flush()
+// AddFlagRequires declares that when flag n is passed then flags rs must be passed as well. All the flags must be already added.
+func (c *CLICmd) AddFlagRequires(n string, rs ...string) {
+	for _, f := range append([]string{n}, rs...) {
+		if c.GetFlag(f) == nil {
+			log.Fatal("Flag " + f + " does not exist")
+		}
 	}
-	if s[1] != "" {
-		fmt.Fprintf(w, "\nOptional flags: \n")
-		fmt.Fprintf(w, s[1])
-		w.Flush()
+	if c.requires == nil {
+		c.requires = make(map[string][]string)
 	}
+	c.requires[n] = append(c.requires[n], rs...)
+}
 
+// AddExclusiveFlags declares that only one of flags ns can be passed. All the flags must be already added.
+func (c *CLICmd) AddExclusiveFlags(ns ...string) {
+	for _, f := range ns {
+		if c.GetFlag(f) == nil {
+			log.Fatal("Flag " + f + " does not exist")
+		}
+	}
+	c.exclusive = append(c.exclusive, ns)
+}
+
+// AddExactlyOneFlags declares that exactly one of flags ns must be passed, eg. one of authentication methods. All the flags must be already added.
+func (c *CLICmd) AddExactlyOneFlags(ns ...string) {
+	for _, f := range ns {
+		if c.GetFlag(f) == nil {
+			log.Fatal("Flag " + f + " does not exist")
+		}
+	}
+	c.exactlyOne = append(c.exactlyOne, ns)
+}
+
+// flagRequires returns flags that flag n requires, including its companion and flags that have n as their companion.
+func (c *CLICmd) flagRequires(n string) []string {
+	rs := append([]string{}, c.requires[n]...)
+	for _, o := range c.GetSortedFlags() {
+		f := c.GetFlag(o)
+		// missing companion is reported by checkConfig
+		if f.companion == "" || c.GetFlag(f.companion) == nil {
+			continue
+		}
+		if o == n {
+			rs = append(rs, f.companion)
+		} else if f.companion == n {
+			rs = append(rs, o)
+		}
+	}
+	return rs
+}
+
+// defaultsOrder returns flags that have default function in order in which defaults have to be evaluated so that flags they depend on are evaluated first.
+// Missing flags and dependency cycles are reported by checkConfig, so here they are skipped.
+func (c *CLICmd) defaultsOrder() []string {
+	order, _ := c.sortDefaults()
+	return order
+}
+
+// sortDefaults returns flags that have default function in order of their dependencies and error when a dependency does not exist or defaults depend on each other.
+func (c *CLICmd) sortDefaults() ([]string, error) {
+	var order []string
+	var err error
+	state := make(map[string]int)
+	var visit func(n string, path []string)
+	visit = func(n string, path []string) {
+		f := c.GetFlag(n)
+		if f == nil {
+			if err == nil {
+				err = errors.New("Flag " + n + " that default of flag " + path[len(path)-1] + " depends on does not exist")
+			}
+			return
+		}
+		if state[n] == 2 || f.defFn == nil {
+			return
+		}
+		if state[n] == 1 {
+			if err == nil {
+				err = errors.New("Default values of flags " + strings.Join(append(path, n), " -> ") + " depend on each other")
+			}
+			return
+		}
+		state[n] = 1
+		for _, d := range f.defDeps {
+			visit(d, append(path, n))
+		}
+		state[n] = 2
+		order = append(order, n)
+	}
+	for _, n := range c.GetSortedFlags() {
+		visit(n, nil)
+	}
+	return order, err
+}
+
+// validateRelations checks parsed flags fs against declared requirements, exclusive groups and exactly-one groups.
+func (c *CLICmd) validateRelations(fs map[string]string) error {
+	for _, n := range c.GetSortedFlags() {
+		if !c.GetFlag(n).isSet(fs[n]) {
+			continue
+		}
+		for _, r := range c.flagRequires(n) {
+			if !c.GetFlag(r).isSet(fs[r]) {
+				return errors.New("Flag " + c.GetFlag(n).label() + " requires " + c.GetFlag(r).label())
+			}
+		}
+	}
+	for _, g := range c.exclusive {
+		var set []string
+		for _, n := range g {
+			if c.GetFlag(n).isSet(fs[n]) {
+				set = append(set, n)
+			}
+		}
+		if len(set) > 1 {
+			return errors.New("Flags " + c.flagLabels(set) + " cannot be used together")
+		}
+	}
+	for _, g := range c.exactlyOne {
+		var set []string
+		for _, n := range g {
+			if c.GetFlag(n).isSet(fs[n]) {
+				set = append(set, n)
+			}
+		}
+		if len(set) == 0 {
+			return errors.New("Exactly one of flags " + c.flagLabels(g) + " is required but none was passed")
+		}
+		if len(set) > 1 {
+			return errors.New("Exactly one of flags " + c.flagLabels(g) + " is required but " + c.flagLabels(set) + " were passed")
+		}
+	}
+	return nil
 }
 
 // AttachFlag attaches instance of CLIFlag to CLICmd.
 func (c *CLICmd) AttachFlag(flag *CLIFlag) {
-	n := flag.name
+	if err := c.flagConflict(flag); err != nil {
+		log.Fatal(err.Error())
+	}
+	n := flag.key()
 	if c.flags == nil {
 		c.flags = make(map[string]*CLIFlag)
 	}
 	c.flags[n] = flag
 }
 
+// flagConflict returns error when name or alias of flag is reserved or already used by another flag of the command. Flagset does not distinguish between - and -- so name of one flag cannot be an alias of another either.
+func (c *CLICmd) flagConflict(flag *CLIFlag) error {
+	for _, n := range []string{flag.name, flag.alias} {
+		if n == "" {
+			continue
+		}
+		if r := c.reservedFlag(n); r != "" {
+			return errors.New("Flag " + n + " of command " + c.name + " is reserved for " + r)
+		}
+		for _, k := range c.GetSortedFlags() {
+			f := c.flags[k]
+			if f.name == n || f.alias == n {
+				return errors.New("Flag " + n + " of command " + c.name + " is already used by flag " + f.label())
+			}
+		}
+	}
+	return nil
+}
+
+// reservedFlag returns what flag name or alias n is reserved for, or empty string when it can be used.
+func (c *CLICmd) reservedFlag(n string) string {
+	if n == "h" || n == "help" {
+		return "help"
+	}
+	if c.printConfig && n == "print-config" {
+		return "printing config"
+	}
+	return ""
+}
+
+// setPrintConfig reserves --print-config flag of the command when b is true. It exits when a flag of the command already uses it.
+func (c *CLICmd) setPrintConfig(b bool) {
+	c.printConfig = b
+	for _, k := range c.GetSortedFlags() {
+		f := c.flags[k]
+		for _, n := range []string{f.name, f.alias} {
+			if n != "" && c.reservedFlag(n) != "" {
+				log.Fatal("Flag " + n + " of command " + c.name + " is reserved for " + c.reservedFlag(n))
+			}
+		}
+	}
+}
+
 // AttachArg attaches instance of CLIFlag to CLICmd but as an argument.
 func (c *CLICmd) AttachArg(flag *CLIFlag) {
 	n := flag.name
@@ -118,14 +395,15 @@ func (c *CLICmd) AttachArg(flag *CLIFlag) {
 	c.argsIdx++
 }
 
-// AddFlag adds a flag to a command. It creates CLIFlag instance and attaches it.
-func (c *CLICmd) AddFlag(n string, a string, hv string, d string, nf int32, fn func(*CLICmd)) {
+// AddFlag adds a flag to a command. It creates CLIFlag instance, attaches it and returns it.
+func (c *CLICmd) AddFlag(n string, a string, hv string, d string, nf int64, fn func(*CLICmd)) *CLIFlag {
 	flg := NewCLIFlag(n, a, hv, d, nf, fn)
 	c.AttachFlag(flg)
+	return flg
 }
 
 // AddArg adds an argument to a command.
-func (c *CLICmd) AddArg(n string, hv string, d string, nf int32) {
+func (c *CLICmd) AddArg(n string, hv string, d string, nf int64) {
 	if c.argsIdx > 9 {
 		log.Fatal("Only 10 arguments are allowed")
 	}
@@ -133,6 +411,26 @@ func (c *CLICmd) AddArg(n string, hv string, d string, nf int32) {
 	c.AttachArg(arg)
 }
 
+// AddVariadicArg adds an argument that takes all the remaining positional values, each of them validated with nf. There must be at least min and, unless max is 0, at most max values. Required flag sets min to be at least 1.
+// Variadic argument comes after all the other arguments and only one can be added.
+func (c *CLICmd) AddVariadicArg(n string, hv string, d string, nf int64, min int, max int) {
+	if c.variadic != nil {
+		log.Fatal("Only one variadic argument is allowed")
+	}
+	if nf&Required > 0 && min < 1 {
+		min = 1
+	}
+	// each value is checked to be present with min instead
+	c.variadic = NewCLIFlag(n, "", hv, d, nf&^Required, nil)
+	c.variadicMin = min
+	c.variadicMax = max
+}
+
+// GetVariadicArg returns instance of CLIFlag of variadic argument.
+func (c *CLICmd) GetVariadicArg() *CLIFlag {
+	return c.variadic
+}
+
 // AddPostValidation attaches an additional validation function that is executed after the default CLI validation
 func (c *CLICmd) AddPostValidation(fn func(*CLI) error) {
 	c.postValidation = fn
@@ -143,6 +441,224 @@ func (c *CLICmd) GetPostValidation() (fn func(*CLI) error) {
 	return c.postValidation
 }
 
+// AddPreRun attaches a function that is executed after successful validation and before the command handler. It is meant for setup like opening connections. When it returns an error the handler is not executed.
+func (c *CLICmd) AddPreRun(fn func(*CLI) error) {
+	c.preRun = fn
+}
+
+// GetPreRun returns pre-run function
+func (c *CLICmd) GetPreRun() (fn func(*CLI) error) {
+	return c.preRun
+}
+
+// SetPassthrough sets whether flags that are not defined in the command are collected instead of being an error. Collected flags are available with CLI.Passthrough in the handler.
+// Value of such flag is kept with it when it is passed after equal sign, eg. --color=always. Otherwise it is treated as a positional argument, unless the flag is set with SetPassthroughValueFlags.
+func (c *CLICmd) SetPassthrough(b bool) {
+	c.passthrough = b
+}
+
+// SetPassthroughValueFlags sets names of undefined flags, without dashes, that take a value. When such flag is passed without equal sign, eg. --color always, the next argument is collected with it as its value.
+func (c *CLICmd) SetPassthroughValueFlags(ns ...string) {
+	c.passValues = ns
+}
+
+// passthroughTakesValue returns true when undefined flag a, passed without equal sign, is set to take the next argument as its value.
+func (c *CLICmd) passthroughTakesValue(a string) bool {
+	if strings.Contains(a, "=") {
+		return false
+	}
+	n := strings.TrimLeft(a, "-")
+	for _, v := range c.passValues {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// SetIgnoreUnknown sets whether flags that are not defined in the command are silently skipped. By default such flags are an error.
+// When passthrough is set as well, undefined flags are collected instead of being skipped.
+func (c *CLICmd) SetIgnoreUnknown(b bool) {
+	c.ignoreUnknown = b
+}
+
+// SetAllowExtraArgs sets whether positional arguments beyond the ones that are added to the command are ignored. By default they are an error, unless the command has a variadic argument.
+func (c *CLICmd) SetAllowExtraArgs(b bool) {
+	c.extraArgs = b
+}
+
+// SetHidden sets whether the command is hidden from the list of commands in help. Hidden command can still be run and completed.
+func (c *CLICmd) SetHidden(b bool) {
+	c.hidden = b
+}
+
+// SetHiddenFromCompletion sets whether the command is left out of CompletionCmds. It does not affect help.
+func (c *CLICmd) SetHiddenFromCompletion(b bool) {
+	c.noCompletion = b
+}
+
+// Count returns how many times flag n was passed in the last parsing.
+func (c *CLICmd) Count(n string) int {
+	return c.counts[n]
+}
+
+// Reset clears state of the last parsing of the command: counts and sources of flags, and file contents and glob matches read during validation. Configuration of the command and its flags is kept. Parsed values are kept by CLI, so use CLI.Reset to clear them as well.
+// Command should not be run nor reset concurrently. To parse many inputs at the same time, build a command for each of them.
+func (c *CLICmd) Reset() {
+	c.counts = nil
+	c.sources = nil
+	for _, f := range c.flags {
+		if f.file != nil {
+			f.file.mu.Lock()
+			f.file.path, f.file.dat = "", nil
+			f.file.mu.Unlock()
+		}
+		if f.glob != nil {
+			f.glob.mu.Lock()
+			f.glob.pattern, f.glob.matches = "", nil
+			f.glob.mu.Unlock()
+		}
+	}
+}
+
+// flagKey returns key of the flag with name or alias fn.
+func (c *CLICmd) flagKey(fn string) string {
+	for k, f := range c.flags {
+		if f.name == fn || f.alias == fn {
+			return k
+		}
+	}
+	return ""
+}
+
+// Source returns where value of flag n comes from in the last parsing: "flag", "env", "secret-file", "config", "default", "prompt" or empty string when flag is not set.
+func (c *CLICmd) Source(n string) string {
+	return c.sources[n]
+}
+
+// Report resolves and validates all the flags of the command in args, which are arguments that follow the command name, without running it. Flags are resolved and validated the same way as in Run, but it does not stop at the first invalid flag, user is not asked for missing values and callbacks are not run.
+// It returns an error when args cannot be parsed at all, eg. there is an undefined flag.
+func (c *CLICmd) Report(cli *CLI, args []string) ([]FlagReport, error) {
+	savedArgs, savedFlags, savedPassthrough := cli.args, cli.parsedFlags, cli.passthrough
+	savedCounts, savedSources := c.counts, c.sources
+	defer func() {
+		cli.args, cli.parsedFlags, cli.passthrough = savedArgs, savedFlags, savedPassthrough
+		c.counts, c.sources = savedCounts, savedSources
+	}()
+	if err := c.checkConfig(); err != nil {
+		return nil, err
+	}
+	cli.args = append([]string{c.name}, args...)
+	nptrs, aptrs, visited, _, err := cli.getFlagSetPtrs(c)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := cli.loadConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	// defaults read values of other flags from CLI
+	cli.parsedFlags = make(map[string]string)
+	c.sources = make(map[string]string)
+	reports := make(map[string]*FlagReport)
+	for _, n := range c.GetSortedFlags() {
+		r := &FlagReport{Name: n}
+		reports[n] = r
+		v, err := cli.parseFlag(c, n, nptrs[n], aptrs[n], visited[n], cfg, false)
+		r.Source = c.sources[n]
+		if err != nil {
+			r.Err = asValidationError(c.GetFlag(n), err)
+			continue
+		}
+		cli.parsedFlags[n] = v
+	}
+	for _, n := range c.defaultsOrder() {
+		f := c.GetFlag(n)
+		if cli.parsedFlags[n] != "" || reports[n].Err != nil {
+			continue
+		}
+		v := f.defFn(cli)
+		reports[n].Source = "default"
+		c.sources[n] = "default"
+		if err := f.ValidateValue(false, v, ""); err != nil {
+			reports[n].Err = asValidationError(f, err)
+			continue
+		}
+		cli.parsedFlags[n], _ = f.normalize(v)
+	}
+
+	var rs []FlagReport
+	redacted := c.redactedFlags()
+	for _, n := range c.GetSortedFlags() {
+		r := reports[n]
+		r.Value = cli.parsedFlags[n]
+		if redacted[n] {
+			if r.Value != "" {
+				r.Value = "********"
+			}
+			if r.Err != nil && r.Err.Value != "" {
+				redacted := *r.Err
+				redacted.Value = "********"
+				r.Err = &redacted
+			}
+		}
+		rs = append(rs, *r)
+	}
+	return rs, nil
+}
+
+// redactedFlags returns keys of flags which values are redacted in the last parsing: Secret flags and flags which default is derived from any of them.
+func (c *CLICmd) redactedFlags() map[string]bool {
+	rs := make(map[string]bool)
+	for k, f := range c.flags {
+		if f.nflags&Secret > 0 {
+			rs[k] = true
+		}
+	}
+	// defaults are in order so the ones derived from other defaults are checked after them
+	for _, k := range c.defaultsOrder() {
+		if c.sources[k] != "default" {
+			continue
+		}
+		for _, d := range c.flags[k].defDeps {
+			if rs[d] {
+				rs[k] = true
+			}
+		}
+	}
+	return rs
+}
+
+// checkConfig returns error in configuration of the command that can be found only when all its flags and arguments are set up. It is checked before they are parsed.
+func (c *CLICmd) checkConfig() error {
+	for _, n := range c.GetSortedFlags() {
+		f := c.flags[n]
+		if err := f.configError(); err != nil {
+			return err
+		}
+		if f.companion != "" && c.GetFlag(f.companion) == nil {
+			return errors.New("Companion " + f.companion + " of flag " + n + " does not exist")
+		}
+	}
+	for _, n := range c.GetSortedArgs() {
+		if err := c.args[n].configError(); err != nil {
+			return err
+		}
+	}
+	_, err := c.sortDefaults()
+	return err
+}
+
+// asValidationError returns err of flag f as ValidationError.
+func asValidationError(f *CLIFlag, err error) *ValidationError {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		errors.As(f.fail("type", f.Type(), "", err.Error()), &verr)
+	}
+	return verr
+}
+
 // GetFlag returns instance of CLIFlag of flag k.
 func (c *CLICmd) GetFlag(k string) *CLIFlag {
 	return c.flags[k]
@@ -164,6 +680,42 @@ func (c *CLICmd) GetSortedFlags() []string {
 	return sfs
 }
 
+// Flags returns instances of CLIFlag of all the flags sorted by their names.
+func (c *CLICmd) Flags() []*CLIFlag {
+	fs := make([]*CLIFlag, 0, len(c.flags))
+	for _, n := range c.GetSortedFlags() {
+		fs = append(fs, c.GetFlag(n))
+	}
+	return fs
+}
+
+// flagTakesValue returns true when argument a is a flag, eg. --name or -n, that takes a value from the next argument.
+func (c *CLICmd) flagTakesValue(a string) bool {
+	if !strings.HasPrefix(a, "-") || strings.Contains(a, "=") {
+		return false
+	}
+	n := strings.TrimLeft(a, "-")
+	for _, f := range c.flags {
+		if (f.name == n || f.alias == n) && f.IsRequireValue() {
+			return true
+		}
+	}
+	return false
+}
+
+// helpRequested returns true when args of the command contain -h or --help that is not a value of the preceding flag and is not after --.
+func (c *CLICmd) helpRequested(args []string) bool {
+	for i, a := range args {
+		if a == "--" {
+			return false
+		}
+		if (a == "-h" || a == "--help" || a == "-help") && (i == 0 || !c.flagTakesValue(args[i-1])) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetFlags returns list of flag names.
 func (c *CLICmd) GetFlags() []reflect.Value {
 	return reflect.ValueOf(c.flags).MapKeys()
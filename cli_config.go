@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SetConfigPaths sets paths of JSON configuration files that are searched in order. The first existing file is loaded and its values are used for flags that are not passed and have no environment variable set.
+// Configuration is an object where keys are keys of flags and values are strings, numbers, booleans or, for AllowMany flags, arrays of them. Environment variables in paths are expanded. Missing files are skipped.
+func (c *CLI) SetConfigPaths(paths ...string) {
+	c.configPaths = paths
+}
+
+// DefaultConfigPaths returns the conventional search paths of configuration file of application app: ./config.json, $XDG_CONFIG_HOME/app/config.json (where $XDG_CONFIG_HOME defaults to ~/.config) and /etc/app/config.json.
+func DefaultConfigPaths(app string) []string {
+	paths := []string{"config.json"}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config")
+		}
+	}
+	if dir != "" {
+		paths = append(paths, filepath.Join(dir, app, "config.json"))
+	}
+	return append(paths, filepath.Join("/etc", app, "config.json"))
+}
+
+// loadConfig returns values of flags of command cmd from the first existing configuration file. Keys that are not flags of the command are ignored.
+func (c *CLI) loadConfig(cmd *CLICmd) (map[string]string, error) {
+	for _, p := range c.configPaths {
+		p = os.ExpandEnv(p)
+		dat, err := os.ReadFile(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.New("Config file " + p + " cannot be read")
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(dat, &raw); err != nil {
+			return nil, errors.New("Config file " + p + " is not a valid JSON object")
+		}
+		cfg := make(map[string]string)
+		for k, rv := range raw {
+			f := cmd.GetFlag(k)
+			if f == nil {
+				continue
+			}
+			v, ok := configValue(f, rv)
+			if !ok {
+				return nil, errors.New("Config file " + p + " has invalid value of flag " + f.label())
+			}
+			cfg[k] = v
+		}
+		return cfg, nil
+	}
+	return nil, nil
+}
+
+// configValue returns JSON value rv from configuration as value of flag f. Array is joined with separator of the flag when it allows many values.
+func configValue(f *CLIFlag, rv interface{}) (string, bool) {
+	switch v := rv.(type) {
+	case string:
+		if f.nflags&(TypeBool|TypeBoolLoose) > 0 {
+			b, ok := parseLooseBool(v)
+			return strconv.FormatBool(b), ok
+		}
+		return v, true
+	case float64:
+		// JSON does not keep the dot of whole numbers but float flags require it
+		if f.nflags&(TypeFloat|TypeRatio) > 0 && v == math.Trunc(v) {
+			return strconv.FormatFloat(v, 'f', 1, 64), true
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64), f.nflags&(TypeBool|TypeBoolLoose) == 0
+	case bool:
+		return strconv.FormatBool(v), true
+	case []interface{}:
+		if f.nflags&AllowMany == 0 {
+			return "", false
+		}
+		vs := make([]string, len(v))
+		for i, e := range v {
+			if _, ok := e.([]interface{}); ok {
+				return "", false
+			}
+			s, ok := configValue(f, e)
+			if !ok {
+				return "", false
+			}
+			vs[i] = s
+		}
+		return strings.Join(vs, f.manySeparator()), true
+	}
+	return "", false
+}
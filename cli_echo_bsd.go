@@ -0,0 +1,26 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package cli
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// setTerminalEcho turns echo of terminal f on or off.
+func setTerminalEcho(f *os.File, on bool) error {
+	var t syscall.Termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCGETA, uintptr(unsafe.Pointer(&t))); errno != 0 {
+		return errno
+	}
+	if on {
+		t.Lflag |= syscall.ECHO
+	} else {
+		t.Lflag &^= syscall.ECHO
+	}
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), syscall.TIOCSETA, uintptr(unsafe.Pointer(&t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd && !windows
+
+package cli
+
+import (
+	"errors"
+	"os"
+)
+
+// setTerminalEcho turns echo of terminal f on or off. It is not supported on this system, so secret values cannot be prompted for.
+func setTerminalEcho(f *os.File, on bool) error {
+	return errors.New("terminal echo cannot be turned off on this system")
+}
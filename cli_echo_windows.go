@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"os"
+	"syscall"
+)
+
+// enableEchoInput is ENABLE_ECHO_INPUT mode of Windows console.
+const enableEchoInput = 0x0004
+
+var procSetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// setTerminalEcho turns echo of console f on or off.
+func setTerminalEcho(f *os.File, on bool) error {
+	var mode uint32
+	if err := syscall.GetConsoleMode(syscall.Handle(f.Fd()), &mode); err != nil {
+		return err
+	}
+	if on {
+		mode |= enableEchoInput
+	} else {
+		mode &^= enableEchoInput
+	}
+	if r, _, err := procSetConsoleMode.Call(f.Fd(), uintptr(mode)); r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"errors"
+)
+
+const (
+	// EventFlagSeen is sent when flag is passed in the arguments.
+	EventFlagSeen = iota
+	// EventFlagValidated is sent when value of a flag is valid.
+	EventFlagValidated
+	// EventValidationFailed is sent when arguments are invalid.
+	EventValidationFailed
+	// EventCmdDispatched is sent just before command handler is run.
+	EventCmdDispatched
+)
+
+// ParseEvent is sent to the function set with SetParseHook.
+type ParseEvent struct {
+	// Kind is one of EventFlagSeen, EventFlagValidated, EventValidationFailed and EventCmdDispatched.
+	Kind int
+	// Cmd is name of the command.
+	Cmd string
+	// Flag is key of the flag, if the event is about a flag.
+	Flag string
+	// Value is value of the flag. It is redacted for Secret flags.
+	Value string
+	// Err is set for EventValidationFailed.
+	Err error
+}
+
+// SetParseHook sets function fn that receives events of parsing, eg. to log them or emit metrics. It is not set by default.
+func (c *CLI) SetParseHook(fn func(ParseEvent)) {
+	c.parseHook = fn
+}
+
+// emit sends event of kind k about flag f of command cmd to the parse hook. Flag can be nil.
+func (c *CLI) emit(k int, cmd *CLICmd, f *CLIFlag, v string, err error) {
+	if c.parseHook == nil {
+		return
+	}
+	e := ParseEvent{Kind: k, Cmd: cmd.name, Value: v, Err: err}
+	if f == nil {
+		var verr *ValidationError
+		if errors.As(err, &verr) {
+			f = cmd.GetFlag(verr.Name)
+		}
+	}
+	if f != nil {
+		e.Flag = f.key()
+		if f.nflags&Secret > 0 && e.Value != "" {
+			e.Value = "********"
+		}
+	}
+	c.parseHook(e)
+}
@@ -1,11 +1,27 @@
 package cli
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -17,9 +33,9 @@ const (
 	TypePathFile = 16
 	// TypeBool sets flag to be boolean.
 	TypeBool = 32
-	// TypeInt sets flag to be integer.
+	// TypeInt sets flag to be integer. Negative values are allowed, eg. --offset -5.
 	TypeInt = 64
-	// TypeFloat sets flag to be float.
+	// TypeFloat sets flag to be float. Negative values are allowed, eg. --offset -1.5.
 	TypeFloat = 128
 	// TypeAlphanumeric sets flag to be alphanumeric.
 	TypeAlphanumeric = 256
@@ -27,7 +43,7 @@ const (
 	MustExist = 512
 	// AllowMany allows flag to have more than one value separated by comma by default.
 	// For example: AllowMany with TypeInt allows values like: 123 or 123,455,666 or 12,222
-	// AllowMany works only with TypeInt, TypeFloat and TypeAlphanumeric.
+	// AllowMany works only with TypeInt, TypeFloat, TypeAlphanumeric, TypeTimeOfDay, TypeTimezone, TypeEmail, TypeFQDN, TypeIPRange, TypeIPMask, TypeDuration, TypeRatio, TypeURLPath, TypeUUID and TypeHTTPHeader.
 	AllowMany = 1024
 	// ManySeparatorColon works with AllowMany and sets colon to be the value separator, instead of colon.
 	ManySeparatorColon = 2048
@@ -47,18 +63,187 @@ const (
 	TypePathDir = 262144
 	// TypePathRegularFile sets flag to be a regular file
 	TypePathRegularFile = 524288
-	// ValidJSON sets flag to be a valid JSON. If it's a file then it's contents is checked. Otherwise it's the value
+	// ValidJSON sets flag to be a valid JSON. If it's a file (TypePathRegularFile) then it's contents is checked. Otherwise (TypeString) it's the value
 	ValidJSON = 1048576
+	// TypeTimeOfDay sets flag to be a time of day in HH:MM or HH:MM:SS format, eg. 14:30 or 14:30:15
+	TypeTimeOfDay = 2097152
+	// TypeTimezone sets flag to be a name of a location from the time zone database, eg. Europe/Warsaw
+	TypeTimezone = 4194304
+	// AllowBasePrefix can be used only with TypeInt and allows value to be prefixed with 0x, 0o or 0b for hexadecimal, octal and binary numbers.
+	// Value is parsed like an integer literal in Go so 017 is an octal number as well.
+	AllowBasePrefix = 8388608
+	// AllowDigitGrouping can be used only with TypeInt and TypeFloat and allows digits to be grouped with a separator, eg. 1_000_000.
+	// Separators can only split integer part into groups of three digits and they are removed before the value is validated. Separator is underscore by default and can be changed with SetGroupingSeparator.
+	AllowDigitGrouping = 16777216
+	// TypeBoolLoose sets flag to be boolean that optionally takes a value, eg. --feature, --feature=yes or --feature off.
+	// Accepted values are the ones of strconv.ParseBool and yes, no, on, off (case insensitive). Flag without a value is true.
+	// Value passed as a separate argument is taken only when it is one of the accepted values. Flag will have a value of "true" or "false".
+	TypeBoolLoose = 33554432
+	// NormalizePath can be used with TypePathFile, TypePathRegularFile and TypePathDir and converts both slashes and backslashes to the separator of the operating system and cleans the path before it is checked.
+	NormalizePath = 67108864
+	// ExpandHome can be used with TypePathFile, TypePathRegularFile and TypePathDir and expands leading ~ to home directory of the user before the path is checked.
+	ExpandHome = 134217728
+	// ResolveSymlinks can be used with TypePathFile, TypePathRegularFile and TypePathDir and replaces path of an existing file with the one that has all the symbolic links resolved.
+	ResolveSymlinks = 268435456
+	// NoFollowSymlinks can be used with TypePathFile, TypePathRegularFile and TypePathDir and rejects path that is a symbolic link itself. It should not be used with ResolveSymlinks.
+	NoFollowSymlinks = 536870912
+	// TypeText sets flag to be a free-form text that can have many lines. Value starting with @ is read from the file, eg. @message.txt, and value of - is read from standard input.
+	// Literal value starting with @ has to be prefixed with another @. Length of the text can be checked with SetLengthRange.
+	TypeText = 1073741824
+	// AllowSpace can be used only with TypeAlphanumeric and additionally allows flag to have spaces. With AllowMany the spaces are part of the values, eg. "John Doe,Jane Doe".
+	AllowSpace = 2147483648
+	// PatternSubstring makes pattern set with SetPattern match anywhere in the value instead of the whole value.
+	PatternSubstring = 4294967296
+	// TypeIPRange sets flag to be a range of IP addresses, eg. 10.0.0.1-10.0.0.50. Both addresses have to be of the same family and the first one cannot be greater than the second one.
+	TypeIPRange = 8589934592
+	// LowercaseDomain can be used only with TypeEmail and lowercases the domain part of the email, eg. John@Example.COM becomes John@example.com. Local part is left untouched.
+	LowercaseDomain = 17179869184
+	// MustResolve can be used only with TypeFQDN and checks if the name resolves with a DNS lookup. The lookup is slow and needs network access so it should be used only when it is really needed.
+	// It times out after 5 seconds by default, which can be changed with SetResolveTimeout.
+	MustResolve = 34359738368
+	// JSONMustBeArray works with ValidJSON and requires the JSON to be an array.
+	JSONMustBeArray = 68719476736
+	// JSONMustBeObject works with ValidJSON and requires the JSON to be an object.
+	JSONMustBeObject = 137438953472
+	// AllowDuplicate allows flag to be passed more than once, in which case the last value wins. Without it, passing flag twice is an error.
+	AllowDuplicate = 274877906944
+	// TypeDuration sets flag to be a duration, eg. 1m30s. Its range can be limited with SetDurationRange.
+	TypeDuration = 549755813888
+	// TypeByteSize sets flag to be a size in bytes with optional suffix, eg. 512, 10KB, 1.5GiB. Decimal suffixes are KB, MB, GB and TB, binary ones are KiB, MiB, GiB and TiB. Its range can be limited with SetByteSizeRange.
+	TypeByteSize = 1099511627776
+	// TypeRate sets flag to be a rate in bytes per second, eg. 5MB/s or 100KiB/s. It accepts the same suffixes as TypeByteSize.
+	TypeRate = 2199023255552
+	// Secret marks flag value as sensitive so it is redacted when configuration is printed.
+	Secret = 4398046511104
+	// CheckContentType works with TypePathRegularFile and requires content of the file to be of type set with SetContentType. Type is detected from the first 512 bytes of the file.
+	CheckContentType = 17592186044416
+	// TypeKeyValue sets flag to be a list of key=value pairs separated by comma (or the separator set with ManySeparatorColon or ManySeparatorSemiColon), eg. cpu=2,mem=4.
+	// Keys are alphanumeric and AllowDots, AllowUnderscore and AllowHyphen apply to them. Type of values can be set with SetKeyValueType.
+	TypeKeyValue = 8796093022208
+	// AnyOfTypes makes value valid when it is valid for any of the types that are set, eg. TypeInt|TypeEmail|AnyOfTypes accepts both 123 and a@example.com.
+	AnyOfTypes = 35184372088832
+	// Experimental makes flag rejected unless experimental features are enabled with --experimental passed before the command or with environment variable set by SetExperimentalEnv. Such flag is hidden from help when they are not enabled.
+	Experimental = 70368744177664
+	// TypeRatio sets flag to be a float between 0 and 1 inclusive, eg. 0.25.
+	TypeRatio = 140737488355328
+	// TrimSpace removes leading and trailing whitespace from the value before it is validated, even when it is not enabled with SetTrimSpace.
+	TrimSpace = 281474976710656
+	// NoTrimSpace keeps leading and trailing whitespace of the value when trimming is enabled with SetTrimSpace.
+	NoTrimSpace = 562949953421312
+	// TypeURLPath sets flag to be an absolute URL path without scheme and host, eg. /api/v1/users. Query and fragment are not allowed.
+	TypeURLPath = 1125899906842624
+	// DotEnv works with TypePathRegularFile and requires the file to be in dotenv format, where each line is KEY=VALUE. Blank lines and comments starting with # are ignored.
+	DotEnv = 2251799813685248
+	// TypeJWT sets flag to be a JSON Web Token made of three base64url encoded segments separated with dots, where header and payload are JSON objects. Signature is not verified.
+	TypeJWT = 4503599627370496
+	// ExpandGlob works with TypePathRegularFile and makes the value a glob pattern, eg. logs/*.txt. Each file matching the pattern is validated as a regular file.
+	ExpandGlob = 9007199254740992
+	// GlobMustMatch works with ExpandGlob and requires the pattern to match at least one file.
+	GlobMustMatch = 18014398509481984
+	// TypeRegexpReplacement sets flag to be a pattern and a replacement wrapped with a delimiter, eg. /foo(.*)/bar$1/ or |a/b|c|. Delimiter is the first character and it can be escaped with backslash. Pattern must compile.
+	TypeRegexpReplacement = 36028797018963968
+	// TypeNonEmpty sets flag to be a string that, when it is passed, cannot be empty or contain only whitespace. Unlike Required, the flag can be omitted.
+	TypeNonEmpty = 72057594037927936
+	// TypeIPMask sets flag to be a dotted subnet mask with contiguous bits, eg. 255.255.255.0.
+	TypeIPMask = 144115188075855872
+	// TypeUUID sets flag to be a UUID in the canonical form, eg. 123e4567-e89b-42d3-a456-426614174000. Version can be required with SetUUIDVersion.
+	TypeUUID = 288230376151711744
+	// TypeHTTPHeader sets flag to be an HTTP header in Name: value form, where name is a token of RFC 7230, eg. "Authorization: Bearer x".
+	// With AllowMany the flag is passed once for each header, eg. -H "Accept: text/html" -H "X-Id: 1", as header values can contain any separator.
+	TypeHTTPHeader = 576460752303423488
 )
 
+// typeMask contains all the flag types.
+const typeMask = TypeString | TypePathFile | TypeBool | TypeInt | TypeFloat | TypeAlphanumeric | TypeEmail | TypeFQDN | TypePathDir | TypePathRegularFile | TypeTimeOfDay | TypeTimezone | TypeBoolLoose | TypeText | TypeIPRange | TypeDuration | TypeByteSize | TypeRate | TypeKeyValue | TypeRatio | TypeURLPath | TypeJWT | TypeRegexpReplacement | TypeNonEmpty | TypeIPMask | TypeUUID | TypeHTTPHeader
+
+// lookupHost resolves host names for MustResolve.
+var lookupHost = net.DefaultResolver.LookupHost
+
+var (
+	// reEmail is the expression used for email input in HTML
+	reEmail = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	// reFQDN matches at least two labels of up to 63 characters with an optional trailing dot
+	reFQDN = regexp.MustCompile("^([a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\\.)+[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\\.?$")
+	// reUUID matches UUID in the canonical form of 8-4-4-4-12 hexadecimal digits
+	reUUID = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+	// reHTTPToken matches token of RFC 7230 that is a name of HTTP header
+	reHTTPToken = regexp.MustCompile("^[a-zA-Z0-9!#$%&'*+.^_`|~-]+$")
+	// reEnvKey matches name of environment variable
+	reEnvKey = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+	// reTimeOfDay matches two digits of hours, minutes and optional seconds
+	reTimeOfDay = regexp.MustCompile("^[0-9]{2}:[0-9]{2}(:[0-9]{2})?$")
+	// reDecimal matches number in decimal notation with optional sign and fraction
+	reDecimal = regexp.MustCompile("^-?[0-9]+(\\.[0-9]+)?$")
+	// reURLPath matches unreserved and sub-delimiter characters, colon, at sign, slash and percent-encoded octets allowed in a path by RFC 3986
+	reURLPath = regexp.MustCompile("^/([a-zA-Z0-9._~!$&'()*+,;=:@/-]|%[0-9a-fA-F]{2})*$")
+)
+
+// ValidationError is returned by ValidateValue. Apart from the message, it tells which rule failed, what form of value was expected and what value was received.
+type ValidationError struct {
+	// Name is a key of the flag or argument.
+	Name string
+	// Rule is one of: missing, conflict, pattern, type, range, length, exists, symlink, base-dir, extension, content-type, size, duplicate, resolve, json, dotenv, stopped.
+	Rule string
+	// Expected describes the expected value, eg. int, existing directory or JSON array.
+	Expected string
+	// Value is the received value.
+	Value string
+	msg   string
+}
+
+// Error returns the message of the error.
+func (e *ValidationError) Error() string {
+	return e.msg
+}
+
 // CLIFlag represends flag. It has a name, alias, description, value that is shown when printing help and configuration which is an integer value. It can be for example Required|TypePathFile|MustExist.
+// Alias is usually a single character and is passed as -a. Alias longer than one character works as a second long name and is passed (and printed in help) as --alias.
 type CLIFlag struct {
 	name      string
 	alias     string
 	helpValue string
 	desc      string
-	nflags    int32
+	nflags    int64
 	fn        func(*CLICmd)
+	groupSep  string
+	env       string
+	minLen    int
+	maxLen    int
+	pattern   *regexp.Regexp
+	resolveTO time.Duration
+	minDur    time.Duration
+	maxDur    time.Duration
+	minSize   int64
+	maxSize   int64
+	companion string
+	kvType    int64
+	baseDir   string
+	exts      []string
+	mimeType  string
+	maxFile   int64
+	defFn     func(*CLI) string
+	defDeps   []string
+	file      *fileCache
+	glob      *globCache
+	depr      bool
+	deprMsg   string
+	removeIn  string
+	secFile   string
+	uuidVer   int
+}
+
+// fileCache keeps contents of the last file read during validation.
+type fileCache struct {
+	mu   sync.Mutex
+	path string
+	dat  []byte
+}
+
+// globCache keeps files matching the last pattern expanded during validation.
+type globCache struct {
+	mu      sync.Mutex
+	pattern string
+	matches []string
 }
 
 // GetHelpLine returns flag usage info that is used when printing help.
@@ -66,23 +251,469 @@ func (c *CLIFlag) GetHelpLine() string {
 	s := " "
 	if c.alias == "" {
 		s += " \t"
+	} else if c.name == "" {
+		s += fmt.Sprintf(" %s\t", c.aliasLabel())
 	} else {
-		s += fmt.Sprintf(" -%s,\t", c.alias)
+		s += fmt.Sprintf(" %s,\t", c.aliasLabel())
+	}
+	if c.name != "" {
+		s += fmt.Sprintf(" --%s", c.name)
+	}
+	// flags that take no value do not print the value placeholder
+	if c.IsRequireValue() {
+		s += fmt.Sprintf(" %s", c.valuePlaceholder())
+	} else if c.nflags&TypeBoolLoose > 0 && c.helpValue != "" {
+		s += fmt.Sprintf(" [=%s]", c.helpValue)
+	}
+	s += fmt.Sprintf(" \t%s", c.desc)
+	if c.env != "" {
+		s += fmt.Sprintf(" [env: %s]", c.env)
+	}
+	if c.depr && c.removeIn != "" {
+		s += fmt.Sprintf(" [deprecated, removed in %s]", c.removeIn)
+	} else if c.depr {
+		s += " [deprecated]"
+	}
+	return s + "\n"
+}
+
+// valuePlaceholder returns value that is shown in help. When it is not set, it is generated from the type, eg. <int>.
+func (c *CLIFlag) valuePlaceholder() string {
+	if c.helpValue != "" || c.Type() == "" {
+		return c.helpValue
+	}
+	return "<" + c.Type() + ">"
+}
+
+// aliasLabel returns alias as it is printed: single character alias is prefixed with one dash and longer alias, which is treated as a second long name, with two dashes.
+func (c *CLIFlag) aliasLabel() string {
+	if len(c.alias) > 1 {
+		return "--" + c.alias
+	}
+	return "-" + c.alias
+}
+
+// label returns flag as it is passed, eg. --name or, for alias-only flags, -a.
+func (c *CLIFlag) label() string {
+	if c.name == "" {
+		return c.aliasLabel()
+	}
+	return "--" + c.name
+}
+
+// isSet returns true when parsed value v means that flag was passed.
+func (c *CLIFlag) isSet(v string) bool {
+	if c.nflags&TypeBool > 0 || c.nflags&TypeBoolLoose > 0 {
+		return v == "true"
+	}
+	return v != ""
+}
+
+// key returns name under which flag is attached to a command. It is the name or, for alias-only flags, the alias.
+func (c *CLIFlag) key() string {
+	if c.name == "" {
+		return c.alias
+	}
+	return c.name
+}
+
+// Name returns name of the flag.
+func (c *CLIFlag) Name() string {
+	return c.name
+}
+
+// Alias returns alias of the flag.
+func (c *CLIFlag) Alias() string {
+	return c.alias
+}
+
+// Desc returns description of the flag.
+func (c *CLIFlag) Desc() string {
+	return c.desc
+}
+
+// HelpValue returns value that is shown in place of the flag value when printing help.
+func (c *CLIFlag) HelpValue() string {
+	return c.helpValue
+}
+
+// Flags returns configuration of the flag, eg. Required|TypePathFile. It is int64 like the configuration passed to NewCLIFlag.
+func (c *CLIFlag) Flags() int64 {
+	return c.nflags
+}
+
+// Type returns name of the flag type decoded from its configuration, eg. "int" for TypeInt. It returns empty string when there is no type.
+func (c *CLIFlag) Type() string {
+	types := []struct {
+		t int64
+		n string
+	}{
+		{TypeString, "string"},
+		{TypePathFile, "path"},
+		{TypePathRegularFile, "file"},
+		{TypePathDir, "dir"},
+		{TypeBool, "bool"},
+		{TypeBoolLoose, "bool"},
+		{TypeInt, "int"},
+		{TypeFloat, "float"},
+		{TypeAlphanumeric, "alphanumeric"},
+		{TypeEmail, "email"},
+		{TypeFQDN, "fqdn"},
+		{TypeTimeOfDay, "time"},
+		{TypeTimezone, "timezone"},
+		{TypeText, "text"},
+		{TypeIPRange, "ip-range"},
+		{TypeDuration, "duration"},
+		{TypeByteSize, "size"},
+		{TypeRate, "rate"},
+		{TypeKeyValue, "key-value"},
+		{TypeRatio, "ratio"},
+		{TypeURLPath, "url-path"},
+		{TypeJWT, "jwt"},
+		{TypeRegexpReplacement, "regexp-replacement"},
+		{TypeNonEmpty, "string"},
+		{TypeIPMask, "ip-mask"},
+		{TypeUUID, "uuid"},
+		{TypeHTTPHeader, "http-header"},
+	}
+	for _, t := range types {
+		if c.nflags&t.t > 0 {
+			return t.n
+		}
+	}
+	return ""
+}
+
+// Completion returns values that shell completion can offer for the flag and a directive when paths should be completed instead: "file", "dir" or empty string.
+func (c *CLIFlag) Completion() ([]string, string) {
+	if c.nflags&TypeBoolLoose > 0 {
+		return []string{"true", "false", "yes", "no", "on", "off"}, ""
+	}
+	if c.nflags&TypePathDir > 0 {
+		return nil, "dir"
+	}
+	if c.nflags&TypePathFile > 0 || c.nflags&TypePathRegularFile > 0 {
+		return nil, "file"
+	}
+	return nil, ""
+}
+
+// SetGroupingSeparator sets separator of digit groups that is removed from the value when AllowDigitGrouping is set.
+func (c *CLIFlag) SetGroupingSeparator(sep string) {
+	c.groupSep = sep
+}
+
+// SetLengthRange sets minimum and maximum number of characters of TypeText flag value or of each TypeAlphanumeric flag value. Maximum of 0 means there is no limit.
+func (c *CLIFlag) SetLengthRange(min int, max int) {
+	c.minLen = min
+	c.maxLen = max
+}
+
+// SetDurationRange sets minimum and maximum value of TypeDuration flag. Maximum of 0 means there is no limit.
+func (c *CLIFlag) SetDurationRange(min time.Duration, max time.Duration) {
+	c.minDur = min
+	c.maxDur = max
+}
+
+// SetByteSizeRange sets minimum and maximum number of bytes of TypeByteSize flag. Maximum of 0 means there is no limit.
+func (c *CLIFlag) SetByteSizeRange(min int64, max int64) {
+	c.minSize = min
+	c.maxSize = max
+}
+
+// SetCompanion sets flag n of the same command that has to be passed together with this flag, eg. --min with --max. When either of them is passed, the other one must be passed as well. Companion that is not a flag of the command is a configuration error reported when the command is run.
+func (c *CLIFlag) SetCompanion(n string) {
+	c.companion = n
+}
+
+// SetKeyValueType sets configuration of values of TypeKeyValue flag, eg. TypeInt. Each value is then validated like a value of such flag. By default values can be any string.
+func (c *CLIFlag) SetKeyValueType(nf int64) {
+	c.kvType = nf
+}
+
+// SetBaseDir sets directory d that path of TypePathFile, TypePathRegularFile or TypePathDir flag has to be inside of. Path is checked after resolving .. and symbolic links so it cannot escape the directory.
+func (c *CLIFlag) SetBaseDir(d string) {
+	c.baseDir = d
+}
+
+// SetExtensions sets extensions that path of TypePathFile, TypePathRegularFile or TypePathDir flag can have, eg. ".pem". Extensions are compared case-insensitively.
+func (c *CLIFlag) SetExtensions(exts ...string) {
+	c.exts = nil
+	for _, e := range exts {
+		c.exts = append(c.exts, "."+strings.ToLower(strings.TrimPrefix(e, ".")))
+	}
+}
+
+// SetContentType sets MIME type, eg. "image/png", that content of the file has to be of when CheckContentType is set. CheckContentType without it is a configuration error.
+func (c *CLIFlag) SetContentType(t string) {
+	c.mimeType = t
+}
+
+// configError returns error in configuration of the flag that can be found only when all its setters are called, eg. CheckContentType without SetContentType.
+func (c *CLIFlag) configError() error {
+	if c.nflags&CheckContentType > 0 && c.mimeType == "" {
+		return errors.New("Flag " + c.key() + ": CheckContentType works only with type set with SetContentType")
+	}
+	return nil
+}
+
+// SetMaxFileSize sets maximum size in bytes of a file of TypePathRegularFile flag. Size of 0 means there is no limit.
+func (c *CLIFlag) SetMaxFileSize(n int64) {
+	c.maxFile = n
+}
+
+// SetDefaultFunc sets function fn that returns value of the flag when it is not passed, eg. directory based on value of another flag. Flags deps that the value depends on are resolved first, including their own defaults.
+// Flags that depend on each other or on a flag that does not exist are a configuration error. Run prints it and returns 1, and Report and ParseQuery return it.
+func (c *CLIFlag) SetDefaultFunc(fn func(*CLI) string, deps ...string) {
+	c.defFn = fn
+	c.defDeps = deps
+}
+
+// SetPattern sets regular expression p that each value of the flag has to match, in addition to the checks of its type. Pattern has to match the whole value unless PatternSubstring is set.
+func (c *CLIFlag) SetPattern(p string) {
+	if c.nflags&PatternSubstring == 0 {
+		p = "^(?:" + p + ")$"
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		log.Fatal("Pattern of flag " + c.key() + " is invalid: " + err.Error())
+	}
+	c.pattern = re
+}
+
+// SetResolveTimeout sets how long DNS lookup of MustResolve flag can take.
+func (c *CLIFlag) SetResolveTimeout(d time.Duration) {
+	c.resolveTO = d
+}
+
+// SetEnv sets name of environment variable which value is used when flag is not passed. For TypeBool flags the value is parsed like in TypeBoolLoose, eg. true, 0, yes or off.
+func (c *CLIFlag) SetEnv(name string) {
+	c.env = name
+}
+
+// SetDeprecated marks flag as deprecated. When it is used, a warning with message msg, eg. "use --new instead", is printed to stderr. Version v in which the flag will be removed is included in the warning, unless it is empty.
+func (c *CLIFlag) SetDeprecated(msg string, v string) {
+	c.depr = true
+	c.deprMsg = msg
+	c.removeIn = v
+}
+
+// Deprecation returns whether flag is deprecated, its deprecation message and version in which it will be removed.
+func (c *CLIFlag) Deprecation() (bool, string, string) {
+	return c.depr, c.deprMsg, c.removeIn
+}
+
+// deprecationWarning returns warning that is printed when deprecated flag is used.
+func (c *CLIFlag) deprecationWarning() string {
+	s := "Flag " + c.label() + " is deprecated"
+	if c.removeIn != "" {
+		s += " and it will be removed in " + c.removeIn
+	}
+	if c.deprMsg != "" {
+		s += ": " + c.deprMsg
 	}
-	s += fmt.Sprintf(" --%s %s \t%s\n", c.name, c.helpValue, c.desc)
 	return s
 }
 
+// SetSecretFile sets path of file, eg. a secret mounted by Docker or Kubernetes, which contents is used when flag is not passed and its environment variable is not set. Empty path means /run/secrets/ followed by key of the flag. Trailing newline is removed from the value.
+// The file is skipped when it does not exist. Flag becomes Secret so its value is redacted.
+func (c *CLIFlag) SetSecretFile(p string) {
+	if p == "" {
+		p = "/run/secrets/" + c.key()
+	}
+	c.secFile = p
+	c.nflags |= Secret
+}
+
+// SetUUIDVersion sets version that UUID of TypeUUID flag must have, eg. 4 for random UUIDs. UUID must also have the RFC 4122 variant. By default any version is accepted.
+func (c *CLIFlag) SetUUIDVersion(v int) {
+	c.uuidVer = v
+}
+
+// normalize returns value v in the form it is validated and passed to the handler. Returned error completes a sentence starting with the flag, eg. "has invalid value".
+func (c *CLIFlag) normalize(v string) (string, error) {
+	if c.nflags&AllowDigitGrouping > 0 && (c.nflags&TypeInt > 0 || c.nflags&TypeFloat > 0) {
+		sep := c.groupSep
+		if sep == "" {
+			sep = "_"
+		}
+		vs := c.values(v)
+		for i, n := range vs {
+			g, ok := ungroupDigits(n, sep)
+			if !ok {
+				return v, errors.New("has invalid digit grouping")
+			}
+			vs[i] = g
+		}
+		v = strings.Join(vs, c.manySeparator())
+	}
+	if c.nflags&ExpandHome > 0 && c.isPath() && (v == "~" || strings.HasPrefix(v, "~/") || strings.HasPrefix(v, "~"+string(filepath.Separator))) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return v, errors.New("cannot be expanded because home directory is unknown")
+		}
+		v = home + v[1:]
+	}
+	if c.nflags&NormalizePath > 0 && c.isPath() && v != "" {
+		v = filepath.Clean(filepath.FromSlash(strings.ReplaceAll(v, "\\", "/")))
+	}
+	if c.nflags&ResolveSymlinks > 0 && c.isPath() && v != "" {
+		// non-existing path is left for the existence check
+		if _, err := os.Lstat(v); err == nil {
+			r, err := filepath.EvalSymlinks(v)
+			if err != nil {
+				return v, errors.New("has a symbolic link that cannot be resolved")
+			}
+			v = r
+		}
+	}
+	if c.nflags&LowercaseDomain > 0 && c.nflags&TypeEmail > 0 && v != "" {
+		es := c.values(v)
+		for i, e := range es {
+			if at := strings.LastIndex(e, "@"); at > -1 {
+				es[i] = e[:at] + strings.ToLower(e[at:])
+			}
+		}
+		v = strings.Join(es, c.manySeparator())
+	}
+	if c.nflags&TypeBoolLoose > 0 {
+		if v == "" {
+			return "false", nil
+		}
+		b, ok := parseLooseBool(v)
+		if !ok {
+			return v, errors.New("has invalid value")
+		}
+		return strconv.FormatBool(b), nil
+	}
+	return v, nil
+}
+
+// isPath returns true when flag is a path to a file or a directory.
+func (c *CLIFlag) isPath() bool {
+	return c.nflags&TypePathFile > 0 || c.nflags&TypePathRegularFile > 0 || c.nflags&TypePathDir > 0
+}
+
+// ungroupDigits returns number v with separators sep of digit groups removed. It returns false when separators do not split integer part of the number into groups of three digits, eg. in 1__000 or 1_000.0_1.
+func ungroupDigits(v string, sep string) (string, bool) {
+	n := strings.TrimPrefix(v, "-")
+	if i := strings.Index(n, "."); i >= 0 {
+		if strings.Contains(n[i:], sep) {
+			return v, false
+		}
+		n = n[:i]
+	}
+	if !strings.Contains(n, sep) {
+		return v, true
+	}
+	for i, g := range strings.Split(n, sep) {
+		if g == "" || len(g) > 3 || (i > 0 && len(g) != 3) || strings.Trim(g, "0123456789") != "" {
+			return v, false
+		}
+	}
+	return strings.ReplaceAll(v, sep, ""), true
+}
+
 // IsRequireValue returns true when flag requires a value (only bool one returns false).
 func (c *CLIFlag) IsRequireValue() bool {
-	return c.nflags&TypeString > 0 || c.nflags&TypePathFile > 0 || c.nflags&TypePathRegularFile > 0 || c.nflags&TypePathDir > 0 || c.nflags&TypeInt > 0 || c.nflags&TypeFloat > 0 || c.nflags&TypeAlphanumeric > 0
+	return c.nflags&TypeString > 0 || c.nflags&TypePathFile > 0 || c.nflags&TypePathRegularFile > 0 || c.nflags&TypePathDir > 0 || c.nflags&TypeInt > 0 || c.nflags&TypeFloat > 0 || c.nflags&TypeAlphanumeric > 0 || c.nflags&TypeTimeOfDay > 0 || c.nflags&TypeTimezone > 0 || c.nflags&TypeEmail > 0 || c.nflags&TypeFQDN > 0 || c.nflags&TypeText > 0 || c.nflags&TypeIPRange > 0 || c.nflags&TypeDuration > 0 || c.nflags&TypeByteSize > 0 || c.nflags&TypeRate > 0 || c.nflags&TypeKeyValue > 0 || c.nflags&TypeRatio > 0 || c.nflags&TypeURLPath > 0 || c.nflags&TypeJWT > 0 || c.nflags&TypeRegexpReplacement > 0 || c.nflags&TypeNonEmpty > 0 || c.nflags&TypeIPMask > 0 || c.nflags&TypeUUID > 0 || c.nflags&TypeHTTPHeader > 0
+}
+
+// Pattern returns regular expression that value of TypeInt, TypeFloat or TypeAlphanumeric flag is matched against. It depends on the type, Allow modifiers and, with AllowMany, on the separator.
+func (c *CLIFlag) Pattern() string {
+	var reType string
+	// set regexp part just for the type (eg. int, float, anum)
+	if c.nflags&TypeInt > 0 {
+		reType = "-?[0-9]+"
+	} else if c.nflags&TypeFloat > 0 {
+		reType = "-?[0-9]{1,16}\\.[0-9]{1,16}"
+	} else if c.nflags&TypeAlphanumeric > 0 {
+		// alphanumeric + each of the additional characters that are allowed
+		chars := "0-9a-zA-Z"
+		if c.nflags&AllowUnderscore > 0 {
+			chars += "_"
+		}
+		if c.nflags&AllowDots > 0 {
+			chars += "\\."
+		}
+		if c.nflags&AllowHyphen > 0 {
+			chars += "\\-"
+		}
+		if c.nflags&AllowSpace > 0 {
+			chars += " "
+		}
+		reType = "[" + chars + "]+"
+	}
+	// create the final regexp depending on if single or many values are allowed
+	if c.nflags&AllowMany > 0 {
+		d := c.manySeparator()
+		return "^" + reType + "(" + d + reType + ")*$"
+	}
+	return "^" + reType + "$"
+}
+
+// patternCache contains compiled patterns of flags keyed by their configuration. Pattern depends only on the configuration so flags of the same type share it.
+var patternCache sync.Map
+
+// compiledPattern returns compiled Pattern of the flag from patternCache.
+func (c *CLIFlag) compiledPattern() *regexp.Regexp {
+	if re, ok := patternCache.Load(c.nflags); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, _ := patternCache.LoadOrStore(c.nflags, regexp.MustCompile(c.Pattern()))
+	return re.(*regexp.Regexp)
+}
+
+// manySeparator returns separator of values when AllowMany is set.
+func (c *CLIFlag) manySeparator() string {
+	if c.nflags&TypeHTTPHeader > 0 {
+		return "\n"
+	}
+	if c.nflags&ManySeparatorColon > 0 {
+		return ":"
+	} else if c.nflags&ManySeparatorSemiColon > 0 {
+		return ";"
+	}
+	return ","
+}
+
+// repeatable returns true when values of flag that is passed many times are collected, instead of being separated in a single value.
+func (c *CLIFlag) repeatable() bool {
+	return c.nflags&TypeHTTPHeader > 0 && c.nflags&AllowMany > 0
+}
+
+// values splits v into values when AllowMany is set. Otherwise v is the only value.
+func (c *CLIFlag) values(v string) []string {
+	if c.nflags&AllowMany > 0 {
+		return strings.Split(v, c.manySeparator())
+	}
+	return []string{v}
 }
 
 // ValidateValue takes value coming from --NAME and -ALIAS and validates it.
+// Empty value is valid for any type of flag that is not Required so optional flags are validated only when they are passed.
+// It is safe to call it concurrently, also for the same flag, as long as the flag is not being configured at the same time.
 func (c *CLIFlag) ValidateValue(isArg bool, nz string, az string) error {
+	return c.ValidateValueContext(context.Background(), isArg, nz, az)
+}
+
+// ValidateValueContext works like ValidateValue but stops when ctx is done. Context is checked before the checks that access files and it limits DNS lookups of MustResolve.
+func (c *CLIFlag) ValidateValueContext(ctx context.Context, isArg bool, nz string, az string) error {
+	if err := ctx.Err(); err != nil {
+		return c.fail("stopped", "", nz+az, "Validation of "+c.key()+" was stopped: "+err.Error())
+	}
+	if err := c.configError(); err != nil {
+		return err
+	}
+	if c.nflags&AnyOfTypes > 0 {
+		return c.validateAnyOfTypes(ctx, isArg, nz, az)
+	}
+	if c.nflags&ExpandGlob > 0 {
+		return c.validateGlob(ctx, isArg, nz, az)
+	}
 	// both alias and name cannot be set
 	if nz != "" && az != "" {
-		return errors.New(fmt.Sprintf("Both -%s and --%s passed", c.alias, c.name))
+		return c.conflictError(nz + az)
 	}
 
 	label := "Flag"
@@ -90,31 +721,76 @@ func (c *CLIFlag) ValidateValue(isArg bool, nz string, az string) error {
 		label = "Argument"
 	}
 
-	nlabel := c.name
+	nlabel := c.key()
 	if isArg {
 		nlabel = c.helpValue
 	}
 
 	// empty
 	if (c.nflags&Required > 0) && (nz == "" && az == "") {
-		if c.nflags&TypeString > 0 || c.nflags&TypePathFile > 0 || c.nflags&TypePathRegularFile > 0 || c.nflags&TypePathDir > 0 || c.nflags&TypeInt > 0 || c.nflags&TypeFloat > 0 || c.nflags&TypeAlphanumeric > 0 {
-			return errors.New(fmt.Sprintf("%s %s is missing", label, nlabel))
+		if c.IsRequireValue() {
+			return c.fail("missing", c.Type(), "", fmt.Sprintf("%s %s is missing", label, nlabel))
+		}
+	}
+	// custom pattern is checked for any value that is passed
+	if c.pattern != nil && (nz != "" || az != "") {
+		for _, p := range c.values(nz + az) {
+			if !c.pattern.MatchString(p) {
+				return c.fail("pattern", c.pattern.String(), p, label+" "+nlabel+" does not match pattern")
+			}
 		}
 	}
-	// string does not need any additional checks apart from the above one
+	// string does not need any additional checks apart from the above ones and JSON
 	if c.nflags&TypeString > 0 {
+		if c.nflags&ValidJSON > 0 && (nz != "" || az != "") {
+			if msg := c.checkJSON([]byte(nz + az)); msg != "" {
+				return c.fail("json", c.expectedJSON(), nz+az, label+" "+nlabel+" "+msg)
+			}
+		}
+		return nil
+	}
+	// non-empty string can be omitted but it cannot be blank
+	if c.nflags&TypeNonEmpty > 0 {
+		if nz+az != "" && strings.TrimSpace(nz+az) == "" {
+			return c.blankError(isArg, nz+az)
+		}
 		return nil
 	}
 	v := az
 	if nz != "" {
 		v = nz
 	}
+	v, err := c.normalize(v)
+	if err != nil {
+		return c.fail("type", c.Type(), v, label+" "+nlabel+" "+err.Error())
+	}
+	// loose bool is fully validated when normalized
+	if c.nflags&TypeBoolLoose > 0 {
+		return nil
+	}
 
 	if c.nflags&Required > 0 || v != "" {
+		if err := ctx.Err(); err != nil {
+			return c.fail("stopped", "", v, "Validation of "+nlabel+" was stopped: "+err.Error())
+		}
+		// path cannot be a symbolic link
+		if c.nflags&NoFollowSymlinks > 0 && c.isPath() {
+			if fileInfo, err := os.Lstat(v); err == nil && fileInfo.Mode()&os.ModeSymlink != 0 {
+				return c.fail("symlink", "path that is not a symbolic link", v, "Path "+v+" from "+nlabel+" is a symbolic link")
+			}
+		}
+		// path cannot be outside of the base directory
+		if c.baseDir != "" && c.isPath() && !isInsideDir(c.baseDir, v) {
+			return c.fail("base-dir", "path inside "+c.baseDir, v, "Path "+v+" from "+nlabel+" escapes directory "+c.baseDir)
+		}
+		// path has to have one of the extensions
+		if len(c.exts) > 0 && c.isPath() && !c.hasExtension(v) {
+			return c.fail("extension", strings.Join(c.exts, ", "), v, "Path "+v+" from "+nlabel+" must have extension "+strings.Join(c.exts, " or "))
+		}
 		// if flag is a file and have to exist
 		if c.nflags&TypePathFile > 0 {
 			if _, err := os.Stat(v); os.IsNotExist(err) {
-				return errors.New("File " + v + " from " + nlabel + " does not exist")
+				return c.fail("exists", "existing file", v, "File "+v+" from "+nlabel+" does not exist")
 			}
 			return nil
 		}
@@ -122,18 +798,42 @@ func (c *CLIFlag) ValidateValue(isArg bool, nz string, az string) error {
 		if c.nflags&TypePathRegularFile > 0 {
 			fileInfo, err := os.Stat(v)
 			if os.IsNotExist(err) {
-				return errors.New("File " + v + " from " + nlabel + " does not exist")
+				return c.fail("exists", "existing regular file", v, "File "+v+" from "+nlabel+" does not exist")
 			}
 			if !fileInfo.Mode().IsRegular() {
-				return errors.New("Path " + v + " from " + nlabel + " is not a regular file")
+				return c.fail("type", "existing regular file", v, "Path "+v+" from "+nlabel+" is not a regular file")
+			}
+			if c.maxFile > 0 && fileInfo.Size() > c.maxFile {
+				return c.fail("size", fmt.Sprintf("at most %d bytes", c.maxFile), v, fmt.Sprintf("File %s from %s has %d bytes which is more than allowed %d bytes", v, nlabel, fileInfo.Size(), c.maxFile))
 			}
-			if c.nflags&ValidJSON > 0 {
+			if c.nflags&(ValidJSON|DotEnv) > 0 {
 				dat, err := os.ReadFile(v)
 				if err != nil {
-					return errors.New(v + " " + nlabel + " cannot be opened")
+					return c.fail("exists", "readable file", v, v+" "+nlabel+" cannot be opened")
+				}
+				if c.nflags&ValidJSON > 0 {
+					if msg := c.checkJSON(dat); msg != "" {
+						return c.fail("json", c.expectedJSON(), v, v+" "+nlabel+" "+msg)
+					}
+				}
+				if c.nflags&DotEnv > 0 {
+					if _, err := parseDotEnv(dat); err != nil {
+						return c.fail("dotenv", "KEY=VALUE lines", v, "File "+v+" from "+nlabel+" "+err.Error())
+					}
+				}
+				if c.file != nil {
+					c.file.mu.Lock()
+					c.file.path, c.file.dat = v, dat
+					c.file.mu.Unlock()
+				}
+			}
+			if c.nflags&CheckContentType > 0 {
+				t, err := detectContentType(v)
+				if err != nil {
+					return c.fail("exists", "readable file", v, v+" "+nlabel+" cannot be opened")
 				}
-				if !json.Valid(dat) {
-					return errors.New(v + " " + nlabel + " is not a valid JSON")
+				if t != c.mimeType {
+					return c.fail("content-type", c.mimeType, v, "File "+v+" from "+nlabel+" is "+t+" instead of "+c.mimeType)
 				}
 			}
 			return nil
@@ -142,63 +842,720 @@ func (c *CLIFlag) ValidateValue(isArg bool, nz string, az string) error {
 		if c.nflags&TypePathDir > 0 {
 			fileInfo, err := os.Stat(v)
 			if os.IsNotExist(err) {
-				return errors.New("Directory " + v + " from " + nlabel + " does not exist")
+				return c.fail("exists", "existing directory", v, "Directory "+v+" from "+nlabel+" does not exist")
 			}
 			if !fileInfo.IsDir() {
-				return errors.New("Path " + v + " from " + nlabel + " is not a directory")
+				return c.fail("type", "existing directory", v, "Path "+v+" from "+nlabel+" is not a directory")
+			}
+			return nil
+		}
+		// time of day - single or many
+		if c.nflags&TypeTimeOfDay > 0 {
+			for _, t := range c.values(v) {
+				if !isTimeOfDay(t) {
+					return c.fail("type", c.Type(), t, label+" "+nlabel+" has invalid value")
+				}
+			}
+			return nil
+		}
+		// text can only have its length checked
+		if c.nflags&TypeText > 0 {
+			return c.validateLength(label, nlabel, v)
+		}
+		// ip range - single or many
+		if c.nflags&TypeIPRange > 0 {
+			for _, r := range c.values(v) {
+				if !isIPRange(r) {
+					return c.fail("type", c.Type(), r, label+" "+nlabel+" has invalid value")
+				}
+			}
+			return nil
+		}
+		// http header - single or many
+		if c.nflags&TypeHTTPHeader > 0 {
+			for _, hv := range c.values(v) {
+				if _, _, ok := parseHTTPHeader(hv); !ok {
+					return c.fail("type", "Name: value", hv, label+" "+nlabel+" has invalid header "+strconv.Quote(hv))
+				}
+			}
+			return nil
+		}
+		// uuid - single or many
+		if c.nflags&TypeUUID > 0 {
+			for _, u := range c.values(v) {
+				if !reUUID.MatchString(u) {
+					return c.fail("type", c.Type(), u, label+" "+nlabel+" has invalid value")
+				}
+				if c.uuidVer > 0 {
+					ver, _ := strconv.ParseInt(u[14:15], 16, 64)
+					want := fmt.Sprintf("version %d UUID", c.uuidVer)
+					if int(ver) != c.uuidVer || !strings.ContainsAny(u[19:20], "89abAB") {
+						return c.fail("type", want, u, fmt.Sprintf("%s %s must be a %s but %s is version %d", label, nlabel, want, u, ver))
+					}
+				}
+			}
+			return nil
+		}
+		// ip mask - single or many
+		if c.nflags&TypeIPMask > 0 {
+			for _, m := range c.values(v) {
+				if !isIPMask(m) {
+					return c.fail("type", c.Type(), m, label+" "+nlabel+" has invalid value")
+				}
+			}
+			return nil
+		}
+		// duration - single or many
+		if c.nflags&TypeDuration > 0 {
+			for _, d := range c.values(v) {
+				pd, err := time.ParseDuration(d)
+				if err != nil {
+					return c.fail("type", c.Type(), d, label+" "+nlabel+" has invalid value")
+				}
+				if pd < c.minDur || (c.maxDur > 0 && pd > c.maxDur) {
+					return c.fail("range", c.expectedDuration(), d, label+" "+nlabel+" must be "+c.expectedDuration())
+				}
+			}
+			return nil
+		}
+		// byte size - single or many
+		if c.nflags&TypeByteSize > 0 {
+			for _, b := range c.values(v) {
+				pb, err := parseByteSize(b)
+				if err != nil {
+					return c.fail("type", c.Type(), b, label+" "+nlabel+" has invalid value")
+				}
+				if pb < c.minSize || (c.maxSize > 0 && pb > c.maxSize) {
+					return c.fail("range", c.expectedByteSize(), b, label+" "+nlabel+" must be "+c.expectedByteSize())
+				}
+			}
+			return nil
+		}
+		// ratio - single or many
+		if c.nflags&TypeRatio > 0 {
+			for _, r := range c.values(v) {
+				if !reDecimal.MatchString(r) {
+					return c.fail("type", c.Type(), r, label+" "+nlabel+" has invalid value")
+				}
+				f, err := strconv.ParseFloat(r, 64)
+				if err != nil {
+					return c.fail("type", c.Type(), r, label+" "+nlabel+" has invalid value")
+				}
+				if f < 0 || f > 1 {
+					return c.fail("range", "between 0 and 1", r, label+" "+nlabel+" must be between 0 and 1")
+				}
+			}
+			return nil
+		}
+		// url path - single or many
+		if c.nflags&TypeURLPath > 0 {
+			for _, p := range c.values(v) {
+				if !isURLPath(p) {
+					return c.fail("type", c.Type(), p, label+" "+nlabel+" has invalid value")
+				}
+			}
+			return nil
+		}
+		// jwt structure only
+		if c.nflags&TypeJWT > 0 {
+			if !isJWT(v) {
+				return c.fail("type", c.Type(), v, label+" "+nlabel+" is not a valid JWT")
+			}
+			return nil
+		}
+		// pattern and replacement
+		if c.nflags&TypeRegexpReplacement > 0 {
+			if _, _, err := parseRegexpReplacement(v); err != nil {
+				return c.fail("type", c.Type(), v, label+" "+nlabel+" "+err.Error())
+			}
+			return nil
+		}
+		// rate - single or many
+		if c.nflags&TypeRate > 0 {
+			for _, r := range c.values(v) {
+				if _, err := parseRate(r); err != nil {
+					return c.fail("type", c.Type(), r, label+" "+nlabel+" has invalid value")
+				}
+			}
+			return nil
+		}
+		// key=value pairs
+		if c.nflags&TypeKeyValue > 0 {
+			kvs, err := c.keyValues(v)
+			if err != nil {
+				return c.fail("type", c.Type(), v, label+" "+nlabel+" "+err.Error())
+			}
+			kf := &CLIFlag{nflags: TypeAlphanumeric | c.nflags&(AllowDots|AllowUnderscore|AllowHyphen)}
+			vf := &CLIFlag{name: c.name, helpValue: c.helpValue, nflags: c.kvType&^AllowMany | Required}
+			for k, kv := range kvs {
+				if !kf.compiledPattern().MatchString(k) {
+					return c.fail("type", "alphanumeric key", k, label+" "+nlabel+" has invalid key "+k)
+				}
+				if c.kvType != 0 {
+					if err := vf.ValidateValueContext(ctx, isArg, kv, ""); err != nil {
+						return c.fail("type", vf.Type(), kv, label+" "+nlabel+" has invalid value of key "+k)
+					}
+				}
+			}
+			return nil
+		}
+		// email or fqdn - single or many
+		if c.nflags&TypeEmail > 0 || c.nflags&TypeFQDN > 0 {
+			re := reFQDN
+			if c.nflags&TypeEmail > 0 {
+				re = reEmail
+			}
+			for _, e := range c.values(v) {
+				if len(e) > 254 || !re.MatchString(e) {
+					return c.fail("type", c.Type(), e, label+" "+nlabel+" has invalid value")
+				}
+				if c.nflags&TypeFQDN > 0 && c.nflags&MustResolve > 0 {
+					if err := c.resolve(ctx, e); err != nil {
+						return c.fail("resolve", "resolvable host", e, "Host "+e+" from "+nlabel+" does not resolve")
+					}
+				}
+			}
+			return nil
+		}
+		// time zone - single or many
+		if c.nflags&TypeTimezone > 0 {
+			for _, tz := range c.values(v) {
+				// empty name would load UTC and Local is the time zone of the host, neither is a name from tz database
+				if tz == "" || tz == "Local" {
+					return c.fail("type", c.Type(), tz, label+" "+nlabel+" has invalid value")
+				}
+				if _, err := time.LoadLocation(tz); err != nil {
+					return c.fail("type", c.Type(), tz, label+" "+nlabel+" has invalid value")
+				}
+			}
+			return nil
+		}
+		// int with base prefix - single or many
+		if c.nflags&TypeInt > 0 && c.nflags&AllowBasePrefix > 0 {
+			for _, i := range c.values(v) {
+				if _, err := c.parseInt(i); err != nil {
+					if errors.Is(err, strconv.ErrRange) {
+						return c.fail("range", c.Type(), i, label+" "+nlabel+" is out of range")
+					}
+					return c.fail("type", c.Type(), i, label+" "+nlabel+" has invalid value")
+				}
 			}
 			return nil
 		}
 		// int, float, alphanumeric - single or many, separated by various chars
-		var reType string
-		var reValue string
-		// set regexp part just for the type (eg. int, float, anum)
-		if c.nflags&TypeInt > 0 {
-			reType = "[0-9]+"
-		} else if c.nflags&TypeFloat > 0 {
-			reType = "[0-9]{1,16}\\.[0-9]{1,16}"
-		} else if c.nflags&TypeAlphanumeric > 0 {
-			// alphanumeric + additional characters
-			if c.nflags&AllowHyphen > 0 && c.nflags&AllowUnderscore > 0 && c.nflags&AllowDots > 0 {
-				reType = "[0-9a-zA-Z_\\.\\-]+"
-			} else if c.nflags&AllowUnderscore > 0 && c.nflags&AllowDots > 0 {
-				reType = "[0-9a-zA-Z_\\.]+"
-			} else if c.nflags&AllowUnderscore > 0 && c.nflags&AllowHyphen > 0 {
-				reType = "[0-9a-zA-Z_\\-]+"
-			} else if c.nflags&AllowDots > 0 && c.nflags&AllowHyphen > 0 {
-				reType = "[0-9a-zA-Z\\.\\-]+"
-			} else if c.nflags&AllowUnderscore > 0 {
-				reType = "[0-9a-zA-Z_]+"
-			} else if c.nflags&AllowDots > 0 {
-				reType = "[0-9a-zA-Z\\.]+"
-			} else {
-				reType = "[0-9a-zA-Z]+"
-			}
-		}
-		// create the final regexp depending on if single or many values are allowed
-		if c.nflags&AllowMany > 0 {
-			var d string
-			if c.nflags&ManySeparatorColon > 0 {
-				d = ":"
-			} else if c.nflags&ManySeparatorSemiColon > 0 {
-				d = ";"
-			} else {
-				d = ","
-			}
-			reValue = "^" + reType + "(" + d + reType + ")*$"
-		} else {
-			reValue = "^" + reType + "$"
+		if !c.compiledPattern().MatchString(v) {
+			return c.fail("type", c.Type(), v, label+" "+nlabel+" has invalid value")
 		}
-		m, err := regexp.MatchString(reValue, v)
-		if err != nil || !m {
-			return errors.New(label + " " + nlabel + " has invalid value")
+		// alphanumeric values can have their length limited and integers matching the pattern can still overflow when they are parsed, floats are limited to 16 digits on each side of the dot by the pattern
+		for _, n := range c.values(v) {
+			if c.nflags&TypeAlphanumeric > 0 {
+				if err := c.validateLength(label, nlabel, n); err != nil {
+					return err
+				}
+			} else if c.nflags&TypeInt > 0 {
+				if _, err := c.parseInt(n); err != nil {
+					return c.fail("range", c.Type(), n, label+" "+nlabel+" is out of range")
+				}
+			}
 		}
 	}
 	return nil
 }
 
-// NewCLIFlag creates instance of CLIFlag and returns it.
-func NewCLIFlag(n string, a string, hv string, d string, nf int32, fn func(*CLICmd)) *CLIFlag {
-	f := &CLIFlag{name: n, alias: a, helpValue: hv, desc: d, nflags: nf, fn: fn}
+// parseInt parses integer value v of the flag.
+func (c *CLIFlag) parseInt(v string) (int64, error) {
+	base := 10
+	if c.nflags&AllowBasePrefix > 0 {
+		// underscores are allowed by ParseInt with base prefix but digit grouping removes them earlier when it is allowed
+		if strings.Contains(v, "_") {
+			return 0, strconv.ErrSyntax
+		}
+		base = 0
+	}
+	return strconv.ParseInt(v, base, 64)
+}
+
+// parseLooseBool parses v as boolean accepting values of strconv.ParseBool and yes, no, on, off. It returns false as the second value when v is not a boolean.
+func parseLooseBool(v string) (bool, bool) {
+	switch strings.ToLower(v) {
+	case "yes", "on":
+		return true, true
+	case "no", "off":
+		return false, true
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, false
+	}
+	return b, true
+}
+
+// looseBool is flag.Value of TypeBoolLoose flag. It is a bool flag for flagset so its value is optional.
+type looseBool struct {
+	v string
+}
+
+func (b *looseBool) String() string {
+	return b.v
+}
+
+func (b *looseBool) Set(s string) error {
+	b.v = s
+	return nil
+}
+
+func (b *looseBool) IsBoolFlag() bool {
+	return true
+}
+
+// conflictError returns error of flag passed with both alias and name, with their values v.
+func (c *CLIFlag) conflictError(v string) error {
+	return c.fail("conflict", "either "+c.aliasLabel()+" or --"+c.name, v, fmt.Sprintf("Both %s and --%s passed", c.aliasLabel(), c.name))
+}
+
+// validateGlob validates ExpandGlob flag by checking its pattern and each file that matches it.
+func (c *CLIFlag) validateGlob(ctx context.Context, isArg bool, nz string, az string) error {
+	sub := *c
+	sub.nflags = c.nflags &^ (ExpandGlob | GlobMustMatch)
+	// missing and conflicting values are not patterns
+	if nz+az == "" || (nz != "" && az != "") {
+		return sub.ValidateValueContext(ctx, isArg, nz, az)
+	}
+	label := "Flag"
+	nlabel := c.key()
+	if isArg {
+		label = "Argument"
+		nlabel = c.helpValue
+	}
+	// pattern is expanded in the form it is passed to the handler
+	p, err := c.normalize(nz + az)
+	if err != nil {
+		return c.fail("type", c.Type(), nz+az, label+" "+nlabel+" "+err.Error())
+	}
+	matches, err := filepath.Glob(p)
+	if err != nil {
+		return c.fail("pattern", "valid glob pattern", p, label+" "+nlabel+" has invalid glob pattern")
+	}
+	if len(matches) == 0 && c.nflags&GlobMustMatch > 0 {
+		return c.fail("exists", "pattern matching files", p, "Pattern "+p+" from "+nlabel+" does not match any file")
+	}
+	for _, m := range matches {
+		if err := sub.ValidateValueContext(ctx, isArg, m, ""); err != nil {
+			return err
+		}
+	}
+	// FlagGlob returns the files that were validated
+	if c.glob != nil {
+		c.glob.mu.Lock()
+		c.glob.pattern, c.glob.matches = p, matches
+		c.glob.mu.Unlock()
+	}
+	return nil
+}
+
+// validateAnyOfTypes validates value against each type of AnyOfTypes flag and returns nil when any of them accepts it.
+func (c *CLIFlag) validateAnyOfTypes(ctx context.Context, isArg bool, nz string, az string) error {
+	var names []string
+	var firstErr *ValidationError
+	for t := int64(1); t <= typeMask; t <<= 1 {
+		if c.nflags&typeMask&t == 0 {
+			continue
+		}
+		sub := *c
+		sub.nflags = c.nflags&^(typeMask|AnyOfTypes) | t
+		err := sub.ValidateValueContext(ctx, isArg, nz, az)
+		if err == nil {
+			return nil
+		}
+		names = append(names, sub.Type())
+		if firstErr == nil {
+			firstErr = asValidationError(c, err)
+		}
+	}
+	if firstErr == nil {
+		return nil
+	}
+	if firstErr.Rule == "missing" || firstErr.Rule == "conflict" || firstErr.Rule == "stopped" {
+		return firstErr
+	}
+	label := "Flag"
+	nlabel := c.key()
+	if isArg {
+		label = "Argument"
+		nlabel = c.helpValue
+	}
+	return c.fail("type", strings.Join(names, " or "), nz+az, label+" "+nlabel+" has invalid value")
+}
+
+// blankError returns error of TypeNonEmpty flag that has blank value v.
+func (c *CLIFlag) blankError(isArg bool, v string) error {
+	if isArg {
+		return c.fail("type", "non-empty value", v, "Argument "+c.helpValue+" cannot be blank")
+	}
+	return c.fail("type", "non-empty value", v, "Flag "+c.key()+" cannot be blank")
+}
+
+// validateLength checks if v has number of characters set with SetLengthRange.
+func (c *CLIFlag) validateLength(label string, nlabel string, v string) error {
+	l := utf8.RuneCountInString(v)
+	if l < c.minLen {
+		return c.fail("length", c.expectedLength(), v, fmt.Sprintf("%s %s must have at least %d characters", label, nlabel, c.minLen))
+	}
+	if c.maxLen > 0 && l > c.maxLen {
+		return c.fail("length", c.expectedLength(), v, fmt.Sprintf("%s %s must have at most %d characters", label, nlabel, c.maxLen))
+	}
+	return nil
+}
+
+// fail returns ValidationError of flag with rule that failed, expected form, received value v and message msg.
+func (c *CLIFlag) fail(rule string, expected string, v string, msg string) error {
+	return &ValidationError{Name: c.key(), Rule: rule, Expected: expected, Value: v, msg: msg}
+}
+
+// expectedLength returns the allowed length of value in human-readable form.
+func (c *CLIFlag) expectedLength() string {
+	if c.maxLen > 0 {
+		return fmt.Sprintf("%d to %d characters", c.minLen, c.maxLen)
+	}
+	return fmt.Sprintf("at least %d characters", c.minLen)
+}
+
+// expectedDuration returns the allowed range of duration in human-readable form.
+func (c *CLIFlag) expectedDuration() string {
+	if c.maxDur > 0 {
+		return "between " + c.minDur.String() + " and " + c.maxDur.String()
+	}
+	return "at least " + c.minDur.String()
+}
+
+// expectedByteSize returns the allowed range of byte size in human-readable form.
+func (c *CLIFlag) expectedByteSize() string {
+	if c.maxSize > 0 {
+		return fmt.Sprintf("between %d and %d bytes", c.minSize, c.maxSize)
+	}
+	return fmt.Sprintf("at least %d bytes", c.minSize)
+}
+
+// expectedJSON returns the expected shape of JSON.
+func (c *CLIFlag) expectedJSON() string {
+	if c.nflags&JSONMustBeArray > 0 {
+		return "JSON array"
+	}
+	if c.nflags&JSONMustBeObject > 0 {
+		return "JSON object"
+	}
+	return "JSON"
+}
+
+// resolve looks up host h within the resolve timeout.
+func (c *CLIFlag) resolve(ctx context.Context, h string) error {
+	to := c.resolveTO
+	if to == 0 {
+		to = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, to)
+	defer cancel()
+	_, err := lookupHost(ctx, h)
+	return err
+}
+
+// jsonData returns JSON of ValidJSON flag with value v: the value itself for TypeString or contents of the file, which is read during validation, for TypePathRegularFile.
+func (c *CLIFlag) jsonData(v string) ([]byte, error) {
+	if c.nflags&TypePathRegularFile == 0 {
+		return []byte(v), nil
+	}
+	return c.fileData(v)
+}
+
+// fileData returns contents of file v, which is read during validation of ValidJSON and DotEnv flags.
+func (c *CLIFlag) fileData(v string) ([]byte, error) {
+	if c.file != nil {
+		c.file.mu.Lock()
+		defer c.file.mu.Unlock()
+		if c.file.path == v {
+			return c.file.dat, nil
+		}
+	}
+	return os.ReadFile(v)
+}
+
+// parseDotEnv returns variables from dotenv file contents dat. Each line is KEY=VALUE, optionally preceded with export, and the value can be in single or double quotes. Blank lines and lines starting with # are skipped.
+func parseDotEnv(dat []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	for i, l := range strings.Split(string(dat), "\n") {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(l, "export "), "=", 2)
+		k := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || !reEnvKey.MatchString(k) {
+			return nil, errors.New(fmt.Sprintf("has invalid assignment on line %d", i+1))
+		}
+		v := strings.TrimSpace(kv[1])
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		}
+		env[k] = v
+	}
+	return env, nil
+}
+
+// checkJSON returns what is wrong with JSON dat, eg. "is not a valid JSON", or empty string when JSON is valid and has the expected shape.
+func (c *CLIFlag) checkJSON(dat []byte) string {
+	if !json.Valid(dat) {
+		return "is not a valid JSON"
+	}
+	first := bytes.TrimLeft(dat, " \t\r\n")[0]
+	if c.nflags&JSONMustBeArray > 0 && first != '[' {
+		return "is not a JSON array"
+	}
+	if c.nflags&JSONMustBeObject > 0 && first != '{' {
+		return "is not a JSON object"
+	}
+	return ""
+}
+
+// byteSizeUnits are multipliers of TypeByteSize suffixes.
+var byteSizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// parseByteSize returns number of bytes in v, eg. 1536 for 1.5KiB. Suffix is case-insensitive.
+func parseByteSize(v string) (int64, error) {
+	i := strings.IndexFunc(v, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i == -1 {
+		i = len(v)
+	}
+	num, unit := v[:i], strings.ToLower(strings.TrimSpace(v[i:]))
+	m, ok := byteSizeUnits[unit]
+	if num == "" || !ok {
+		return 0, errors.New("has invalid unit")
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, err
+	}
+	b := f * m
+	if b >= math.MaxInt64 {
+		return 0, strconv.ErrRange
+	}
+	return int64(b), nil
+}
+
+// parseRate returns number of bytes per second in v, eg. 5000000 for 5MB/s.
+func parseRate(v string) (int64, error) {
+	if !strings.HasSuffix(v, "/s") {
+		return 0, errors.New("has invalid unit")
+	}
+	return parseByteSize(strings.TrimSuffix(v, "/s"))
+}
+
+// keyValues splits v of TypeKeyValue flag into map of keys and values.
+func (c *CLIFlag) keyValues(v string) (map[string]string, error) {
+	kvs := make(map[string]string)
+	for _, p := range strings.Split(v, c.manySeparator()) {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.New("has invalid key=value pair")
+		}
+		if _, ok := kvs[kv[0]]; ok {
+			return nil, errors.New("has duplicated key " + kv[0])
+		}
+		kvs[kv[0]] = kv[1]
+	}
+	return kvs, nil
+}
+
+// hasExtension returns true when path p has one of the extensions set with SetExtensions.
+func (c *CLIFlag) hasExtension(p string) bool {
+	ext := strings.ToLower(filepath.Ext(p))
+	for _, e := range c.exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// detectContentType returns MIME type of file at path p without parameters, eg. "text/plain".
+func detectContentType(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	t := http.DetectContentType(buf[:n])
+	return strings.TrimSpace(strings.SplitN(t, ";", 2)[0]), nil
+}
+
+// resolvePath returns absolute path of p with symbolic links resolved. Path that does not exist is only cleaned.
+func resolvePath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	if r, err := filepath.EvalSymlinks(p); err == nil {
+		return r
+	}
+	return filepath.Clean(p)
+}
+
+// isInsideDir returns true when path p is directory d or is inside of it.
+func isInsideDir(d string, p string) bool {
+	rel, err := filepath.Rel(resolvePath(d), resolvePath(p))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isIPRange returns true when v is a range of IP addresses of the same family separated with hyphen and the first one is not greater than the second one.
+func isIPRange(v string) bool {
+	ips := strings.Split(v, "-")
+	if len(ips) != 2 {
+		return false
+	}
+	start := net.ParseIP(ips[0])
+	end := net.ParseIP(ips[1])
+	if start == nil || end == nil || (start.To4() == nil) != (end.To4() == nil) {
+		return false
+	}
+	return bytes.Compare(start.To16(), end.To16()) <= 0
+}
+
+// isURLPath returns true when v is parsed as URL that has only the path set and it starts with a slash.
+func isURLPath(v string) bool {
+	if !reURLPath.MatchString(v) || strings.HasPrefix(v, "//") {
+		return false
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" && u.Host == "" && u.User == nil && u.Opaque == "" && u.RawQuery == "" && u.Fragment == "" && u.Path != ""
+}
+
+// isJWT returns true when v has header, payload and signature separated with dots, all of them base64url encoded without padding, and header and payload are JSON objects.
+func isJWT(v string) bool {
+	segs := strings.Split(v, ".")
+	if len(segs) != 3 {
+		return false
+	}
+	for i, seg := range segs {
+		dat, err := base64.RawURLEncoding.DecodeString(seg)
+		if err != nil {
+			return false
+		}
+		if i < 2 {
+			var obj map[string]interface{}
+			if json.Unmarshal(dat, &obj) != nil || obj == nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseRegexpReplacement returns compiled pattern and replacement from v wrapped with a delimiter, eg. /foo/bar/. Escaped delimiter is unescaped.
+func parseRegexpReplacement(v string) (*regexp.Regexp, string, error) {
+	d, size := utf8.DecodeRuneInString(v)
+	if size == 0 || d == '\\' || d == utf8.RuneError || unicode.IsLetter(d) || unicode.IsDigit(d) || unicode.IsSpace(d) {
+		return nil, "", errors.New("has invalid delimiter")
+	}
+	var parts []string
+	var part strings.Builder
+	rest := v[size:]
+	for len(rest) > 0 {
+		r, n := utf8.DecodeRuneInString(rest)
+		if r == '\\' && strings.HasPrefix(rest[n:], string(d)) {
+			part.WriteRune(d)
+			rest = rest[n+size:]
+			continue
+		}
+		if r == '\\' && len(rest) > n {
+			// other escapes are kept for the pattern
+			next, m := utf8.DecodeRuneInString(rest[n:])
+			part.WriteRune(r)
+			part.WriteRune(next)
+			rest = rest[n+m:]
+			continue
+		}
+		if r == d {
+			parts = append(parts, part.String())
+			part.Reset()
+		} else {
+			part.WriteRune(r)
+		}
+		rest = rest[n:]
+	}
+	if len(parts) != 2 || part.Len() > 0 {
+		return nil, "", errors.New("must be a pattern and a replacement wrapped with " + string(d))
+	}
+	re, err := regexp.Compile(parts[0])
+	if err != nil {
+		return nil, "", errors.New("has invalid pattern")
+	}
+	return re, parts[1], nil
+}
+
+// isIPMask returns true when v is an IPv4 address that is a canonical mask, where ones are followed by zeros.
+func isIPMask(v string) bool {
+	ip := net.ParseIP(v).To4()
+	if ip == nil || strings.Contains(v, ":") {
+		return false
+	}
+	_, bits := net.IPMask(ip).Size()
+	return bits == 32
+}
+
+// parseHTTPHeader returns name and value of header v in Name: value form. Name must be a token and value cannot contain control characters other than tab.
+func parseHTTPHeader(v string) (string, string, bool) {
+	kv := strings.SplitN(v, ":", 2)
+	if len(kv) != 2 || !reHTTPToken.MatchString(kv[0]) {
+		return "", "", false
+	}
+	val := strings.Trim(kv[1], " \t")
+	for _, r := range val {
+		if (r < ' ' && r != '\t') || r == 0x7f {
+			return "", "", false
+		}
+	}
+	return kv[0], val, true
+}
+
+// isTimeOfDay returns true when v is a valid time in HH:MM or HH:MM:SS format.
+func isTimeOfDay(v string) bool {
+	// layout of time.Parse accepts hours with one digit
+	if !reTimeOfDay.MatchString(v) {
+		return false
+	}
+	if _, err := time.Parse("15:04", v); err == nil {
+		return true
+	}
+	if _, err := time.Parse("15:04:05", v); err == nil {
+		return true
+	}
+	return false
+}
+
+// NewCLIFlag creates instance of CLIFlag and returns it. Either name n or alias a can be empty but not both of them.
+func NewCLIFlag(n string, a string, hv string, d string, nf int64, fn func(*CLICmd)) *CLIFlag {
+	if n == "" && a == "" {
+		log.Fatal("Flag must have a name or an alias")
+	}
+	f := &CLIFlag{name: n, alias: a, helpValue: hv, desc: d, nflags: nf, fn: fn, file: &fileCache{}, glob: &globCache{}}
 	return f
 }
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"log"
+)
+
+// FlagBuilder builds CLIFlag with chained calls instead of a configuration integer, eg. NewFlag("config").Alias("c").PathFile().MustExist().Required().Build().
+// Setting a type replaces the previously set one and Build checks that modifiers work with the type.
+type FlagBuilder struct {
+	name      string
+	alias     string
+	helpValue string
+	desc      string
+	nflags    int64
+	fn        func(*CLICmd)
+	env       string
+}
+
+// NewFlag creates FlagBuilder of flag with name n.
+func NewFlag(n string) *FlagBuilder {
+	return &FlagBuilder{name: n}
+}
+
+// Alias sets alias of the flag.
+func (b *FlagBuilder) Alias(a string) *FlagBuilder {
+	b.alias = a
+	return b
+}
+
+// HelpValue sets value that is shown in help.
+func (b *FlagBuilder) HelpValue(hv string) *FlagBuilder {
+	b.helpValue = hv
+	return b
+}
+
+// Desc sets description of the flag.
+func (b *FlagBuilder) Desc(d string) *FlagBuilder {
+	b.desc = d
+	return b
+}
+
+// OnSet sets function that is called when flag is set to true.
+func (b *FlagBuilder) OnSet(fn func(*CLICmd)) *FlagBuilder {
+	b.fn = fn
+	return b
+}
+
+// Env sets environment variable that the value is taken from when flag is not passed.
+func (b *FlagBuilder) Env(e string) *FlagBuilder {
+	b.env = e
+	return b
+}
+
+// setType replaces type of the flag with t.
+func (b *FlagBuilder) setType(t int64) *FlagBuilder {
+	b.nflags = b.nflags&^typeMask | t
+	return b
+}
+
+// String sets flag to be TypeString.
+func (b *FlagBuilder) String() *FlagBuilder {
+	return b.setType(TypeString)
+}
+
+// PathFile sets flag to be TypePathFile.
+func (b *FlagBuilder) PathFile() *FlagBuilder {
+	return b.setType(TypePathFile)
+}
+
+// RegularFile sets flag to be TypePathRegularFile.
+func (b *FlagBuilder) RegularFile() *FlagBuilder {
+	return b.setType(TypePathRegularFile)
+}
+
+// Dir sets flag to be TypePathDir.
+func (b *FlagBuilder) Dir() *FlagBuilder {
+	return b.setType(TypePathDir)
+}
+
+// Bool sets flag to be TypeBool.
+func (b *FlagBuilder) Bool() *FlagBuilder {
+	return b.setType(TypeBool)
+}
+
+// Int sets flag to be TypeInt.
+func (b *FlagBuilder) Int() *FlagBuilder {
+	return b.setType(TypeInt)
+}
+
+// Float sets flag to be TypeFloat.
+func (b *FlagBuilder) Float() *FlagBuilder {
+	return b.setType(TypeFloat)
+}
+
+// Alphanumeric sets flag to be TypeAlphanumeric.
+func (b *FlagBuilder) Alphanumeric() *FlagBuilder {
+	return b.setType(TypeAlphanumeric)
+}
+
+// Email sets flag to be TypeEmail.
+func (b *FlagBuilder) Email() *FlagBuilder {
+	return b.setType(TypeEmail)
+}
+
+// FQDN sets flag to be TypeFQDN.
+func (b *FlagBuilder) FQDN() *FlagBuilder {
+	return b.setType(TypeFQDN)
+}
+
+// Duration sets flag to be TypeDuration.
+func (b *FlagBuilder) Duration() *FlagBuilder {
+	return b.setType(TypeDuration)
+}
+
+// ByteSize sets flag to be TypeByteSize.
+func (b *FlagBuilder) ByteSize() *FlagBuilder {
+	return b.setType(TypeByteSize)
+}
+
+// Required sets flag to be required.
+func (b *FlagBuilder) Required() *FlagBuilder {
+	b.nflags |= Required
+	return b
+}
+
+// MustExist sets path of the flag to exist.
+func (b *FlagBuilder) MustExist() *FlagBuilder {
+	b.nflags |= MustExist
+	return b
+}
+
+// AllowMany allows flag to have more than one value.
+func (b *FlagBuilder) AllowMany() *FlagBuilder {
+	b.nflags |= AllowMany
+	return b
+}
+
+// AllowDots allows alphanumeric flag to contain dots.
+func (b *FlagBuilder) AllowDots() *FlagBuilder {
+	b.nflags |= AllowDots
+	return b
+}
+
+// AllowUnderscore allows alphanumeric flag to contain underscores.
+func (b *FlagBuilder) AllowUnderscore() *FlagBuilder {
+	b.nflags |= AllowUnderscore
+	return b
+}
+
+// AllowHyphen allows alphanumeric flag to contain hyphens.
+func (b *FlagBuilder) AllowHyphen() *FlagBuilder {
+	b.nflags |= AllowHyphen
+	return b
+}
+
+// ValidJSON sets value of string flag or content of regular file to be a valid JSON.
+func (b *FlagBuilder) ValidJSON() *FlagBuilder {
+	b.nflags |= ValidJSON
+	return b
+}
+
+// Build creates CLIFlag. It exits when a modifier does not work with the type of the flag.
+func (b *FlagBuilder) Build() *CLIFlag {
+	t := b.nflags & typeMask
+	if b.nflags&MustExist > 0 && t != TypePathFile {
+		log.Fatal("Flag " + b.name + ": MustExist works only with a path to a file")
+	}
+	if b.nflags&(AllowDots|AllowUnderscore|AllowHyphen) > 0 && t != TypeAlphanumeric {
+		log.Fatal("Flag " + b.name + ": AllowDots, AllowUnderscore and AllowHyphen work only with an alphanumeric flag")
+	}
+	if b.nflags&ValidJSON > 0 && t != TypeString && t != TypePathRegularFile {
+		log.Fatal("Flag " + b.name + ": ValidJSON works only with a string or a regular file")
+	}
+	f := NewCLIFlag(b.name, b.alias, b.helpValue, b.desc, b.nflags, b.fn)
+	if b.env != "" {
+		f.SetEnv(b.env)
+	}
+	return f
+}
@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"log"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// HelpData is passed to help template of a command.
+type HelpData struct {
+	// Tool is name of the executable.
+	Tool string
+	// Name is name of the command.
+	Name string
+	// Description is description of the command.
+	Description string
+	// Usage is one-line synopsis of the command, as returned by CLICmd.Usage.
+	Usage string
+	// RequiredFlags and OptionalFlags are flags of the command sorted by key. Experimental flags are left out unless they are enabled.
+	RequiredFlags []HelpFlag
+	OptionalFlags []HelpFlag
+	// SeeAlso are related commands prefixed with the tool, eg. "tool deploy".
+	SeeAlso []string
+}
+
+// HelpFlag describes flag in HelpData.
+type HelpFlag struct {
+	// Name and Alias are passed as --name and -a. Any of them can be empty.
+	Name  string
+	Alias string
+	// Value is a placeholder of the value, eg. FILE or <int>. It is empty for flags that take no value.
+	Value string
+	// Description is description of the flag.
+	Description string
+	// Line is the flag as it is printed in the default help, with columns aligned with other flags and relationships with them.
+	Line string
+}
+
+// SetHelpTemplate sets text/template that renders help of all the commands, unless a command has its own template set with CLICmd.SetHelpTemplate. Template receives HelpData. It exits when template cannot be parsed.
+func (c *CLI) SetHelpTemplate(t string) {
+	c.helpTmpl = parseHelpTemplate("help", t)
+}
+
+// SetHelpTemplate sets text/template that renders help of the command. Template receives HelpData. It exits when template cannot be parsed.
+func (c *CLICmd) SetHelpTemplate(t string) {
+	c.helpTmpl = parseHelpTemplate(c.name, t)
+}
+
+// parseHelpTemplate returns template t with name n and exits when it is invalid.
+func parseHelpTemplate(n string, t string) *template.Template {
+	tmpl, err := template.New(n).Parse(t)
+	if err != nil {
+		log.Fatal("Help template of " + n + " is invalid: " + err.Error())
+	}
+	return tmpl
+}
+
+// helpTemplate returns help template of the command or, when it is not set, the one of cli. It returns nil when there is none.
+func (c *CLICmd) helpTemplate(cli *CLI) *template.Template {
+	if c.helpTmpl != nil {
+		return c.helpTmpl
+	}
+	return cli.helpTmpl
+}
+
+// helpData returns data of help of the command.
+func (c *CLICmd) helpData(cli *CLI) HelpData {
+	tool := path.Base(os.Args[0])
+	d := HelpData{Tool: tool, Name: c.name, Description: c.desc, Usage: c.Usage()}
+	var flags []HelpFlag
+	var lines []string
+	var required []bool
+	for _, n := range c.GetSortedFlags() {
+		f := c.GetFlag(n)
+		if f.nflags&Experimental > 0 && !cli.experimentalEnabled() {
+			continue
+		}
+		hf := HelpFlag{Name: f.name, Alias: f.alias, Description: f.desc}
+		if f.IsRequireValue() {
+			hf.Value = f.valuePlaceholder()
+		}
+		flags = append(flags, hf)
+		lines = append(lines, c.annotateHelpLine(n, f.GetHelpLine()))
+		required = append(required, f.nflags&Required > 0)
+	}
+	// required and optional flags are aligned together
+	for i, l := range alignColumns(lines, cli.helpWidth) {
+		flags[i].Line = strings.TrimSuffix(l, "\n")
+		if required[i] {
+			d.RequiredFlags = append(d.RequiredFlags, flags[i])
+		} else {
+			d.OptionalFlags = append(d.OptionalFlags, flags[i])
+		}
+	}
+	for _, r := range c.seeAlso {
+		d.SeeAlso = append(d.SeeAlso, tool+" "+r)
+	}
+	return d
+}
+
+// SetHelpWidth sets maximum width of help lines. Descriptions of commands and flags that do not fit are wrapped and aligned with the description column. By default (0) they are not wrapped.
+func (c *CLI) SetHelpWidth(w int) {
+	c.helpWidth = w
+}
+
+// alignColumns returns lines of tab-separated cells with each column padded with spaces to the longest cell in it, so that the last column, which is a description, starts at the same position in all the lines.
+// Description is wrapped when line is longer than w, unless w is 0.
+func alignColumns(lines []string, w int) []string {
+	rows := make([][]string, len(lines))
+	var widths []int
+	for i, l := range lines {
+		cells := strings.Split(strings.TrimSuffix(l, "\n"), "\t")
+		for j := range cells {
+			cells[j] = strings.TrimSpace(cells[j])
+			if j == len(cells)-1 {
+				continue
+			}
+			if j >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if n := utf8.RuneCountInString(cells[j]); n > widths[j] {
+				widths[j] = n
+			}
+		}
+		rows[i] = cells
+	}
+	out := make([]string, len(rows))
+	for i, cells := range rows {
+		prefix := " "
+		for j, cell := range cells[:len(cells)-1] {
+			prefix += " " + cell + strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell))
+		}
+		// rows with fewer cells have their description aligned with the others
+		for j := len(cells) - 1; j < len(widths); j++ {
+			prefix += " " + strings.Repeat(" ", widths[j])
+		}
+		prefix += "  "
+		out[i] = wrapText(prefix, cells[len(cells)-1], w) + "\n"
+	}
+	return out
+}
+
+// wrapText returns prefix followed by words of text s wrapped at width w, with the following lines indented to the length of prefix.
+func wrapText(prefix string, s string, w int) string {
+	if w <= 0 {
+		return strings.TrimRight(prefix+s, " ")
+	}
+	indent := strings.Repeat(" ", utf8.RuneCountInString(prefix))
+	l, n := prefix, 0
+	var b strings.Builder
+	for _, word := range strings.Fields(s) {
+		if n > 0 && utf8.RuneCountInString(l)+1+utf8.RuneCountInString(word) > w {
+			b.WriteString(l + "\n")
+			l, n = indent, 0
+		}
+		if n > 0 {
+			l += " "
+		}
+		l += word
+		n++
+	}
+	b.WriteString(strings.TrimRight(l, " "))
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// Handler is a function that handles a command and returns its exit code.
+type Handler func(*CLI) int
+
+// Middleware wraps handler next with code that runs around it, eg. timing or authorisation checks.
+type Middleware func(next Handler) Handler
+
+// Use adds middleware that wraps handlers of all commands. Middleware added first runs first, so it is the outermost one.
+func (c *CLI) Use(mw ...Middleware) {
+	c.middleware = append(c.middleware, mw...)
+}
+
+// wrapHandler returns handler of command cmd wrapped with all the middleware. When panics are recovered with SetRecoverPanics, Recover is the outermost one.
+func (c *CLI) wrapHandler(cmd *CLICmd) Handler {
+	h := Handler(cmd.Run)
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		h = c.middleware[i](h)
+	}
+	if c.panics {
+		h = Recover(h)
+	}
+	return h
+}
+
+// Recover is a middleware that recovers from panic in the handler. Panic is printed to stderr as an error with its stack trace and 1 is returned.
+func Recover(next Handler) Handler {
+	return func(c *CLI) int {
+		what := "Command"
+		if c.cmd != nil {
+			what += " " + c.cmd.name
+		}
+		code := 1
+		c.recoverPanic(what, func() { code = next(c) })
+		return code
+	}
+}
+
+// SetRecoverPanics sets whether panic in a command handler or a flag callback is recovered. When it is, handlers are wrapped with Recover and panic in a flag callback is printed the same way. It is not set by default so that bugs are not hidden during development.
+func (c *CLI) SetRecoverPanics(b bool) {
+	c.panics = b
+}
+
+// recovered runs fn, which is described with what, and returns false when it panicked. Panic is recovered only when it is set with SetRecoverPanics.
+func (c *CLI) recovered(what string, fn func()) bool {
+	if !c.panics {
+		fn()
+		return true
+	}
+	return c.recoverPanic(what, fn)
+}
+
+// recoverPanic runs fn, which is described with what, and returns false when it panicked. Panic is printed to stderr with its stack trace.
+func (c *CLI) recoverPanic(what string, fn func()) bool {
+	if err := catchPanic(fn); err != nil {
+		fmt.Fprintf(c.stderr, "ERROR: %s panicked: %s\n", what, err.Error())
+		return false
+	}
+	return true
+}
+
+// catchPanic runs fn and returns panic raised in it as error with the stack trace.
+func catchPanic(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New(fmt.Sprintf("%v\n%s", r, debug.Stack()))
+		}
+	}()
+	fn()
+	return nil
+}
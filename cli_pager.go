@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// SetPager sets whether help is shown with pager from PAGER environment variable, or less when it is not set. Pager is used only when stdout is a terminal and help is printed normally when pager cannot be started.
+func (c *CLI) SetPager(b bool) {
+	c.pager = b
+}
+
+// page runs print with stdout file piped to the pager.
+func (c *CLI) page(print func()) {
+	if !c.pager || !isTerminal(c.stdout) {
+		print()
+		return
+	}
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less"}
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		print()
+		return
+	}
+	defer r.Close()
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = r
+	cmd.Stdout = c.stdout
+	cmd.Stderr = c.stderr
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		print()
+		return
+	}
+	stdout := c.stdout
+	c.stdout = w
+	print()
+	c.stdout = stdout
+	w.Close()
+	cmd.Wait()
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// isTerminal returns true when f is a terminal. It can be replaced in tests.
+var isTerminal = func(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// setEcho turns echo of terminal f on or off. It can be replaced in tests.
+var setEcho = setTerminalEcho
+
+// SetInteractivePrompt sets whether values of missing required flags are asked for when stdin is a terminal. It is disabled by default and it never prompts when stdin is not a terminal.
+// Values of Secret flags are read without echo and the flag is an error when echo cannot be turned off.
+func (c *CLI) SetInteractivePrompt(b bool) {
+	c.interactive = b
+}
+
+// getStdin returns file set with SetStdin or os.Stdin.
+func (c *CLI) getStdin() *os.File {
+	if c.stdin != nil {
+		return c.stdin
+	}
+	return os.Stdin
+}
+
+// canPrompt returns true when interactive prompt is enabled and stdin is a terminal.
+func (c *CLI) canPrompt() bool {
+	return c.interactive && isTerminal(c.getStdin())
+}
+
+// prompt asks for value of flag f until a valid one is entered. It returns an error when there is no more input.
+func (c *CLI) prompt(f *CLIFlag) (string, error) {
+	if c.stdinReader == nil {
+		c.stdinReader = bufio.NewReader(c.getStdin())
+	}
+	for {
+		fmt.Fprintf(c.stderr, "%s (%s): ", f.desc, f.label())
+		l, err := c.readLine(f.nflags&Secret > 0)
+		if err == errNoEcho {
+			fmt.Fprintf(c.stderr, "\n")
+			return "", errors.New("Flag " + f.key() + " is secret and it cannot be read without echo")
+		}
+		if err != nil && (err != io.EOF || l == "") {
+			fmt.Fprintf(c.stderr, "\n")
+			return "", errors.New("Flag " + f.key() + " is missing")
+		}
+		// line ending is removed before validation, and so is whitespace when it is trimmed
+		v := c.trimValue(f, strings.TrimRight(l, "\r\n"))
+		if err := f.ValidateValue(false, v, ""); err != nil {
+			fmt.Fprintf(c.stderr, "ERROR: %s\n", err)
+			continue
+		}
+		return v, nil
+	}
+}
+
+// errNoEcho is returned by readLine when echo cannot be turned off.
+var errNoEcho = errors.New("echo cannot be turned off")
+
+// readLine reads line from stdin. When secret is true, echo of the terminal is turned off while reading.
+func (c *CLI) readLine(secret bool) (string, error) {
+	if secret {
+		if err := setEcho(c.getStdin(), false); err != nil {
+			return "", errNoEcho
+		}
+		defer func() {
+			setEcho(c.getStdin(), true)
+			// newline typed by the user is not echoed
+			fmt.Fprintf(c.stderr, "\n")
+		}()
+	}
+	return c.stdinReader.ReadString('\n')
+}
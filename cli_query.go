@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ParseQuery parses flags and arguments of command n from query string q, eg. name=foo&count=3, and validates them like Run does, including values from environment, secret files and config files.
+// Keys are names or aliases of flags and names of arguments. Bool flag without value is true. Values are then available with Flag and Arg. Command handler is not run.
+func (c *CLI) ParseQuery(n string, q string) error {
+	cmd := c.GetCmd(n)
+	if cmd == nil {
+		return errors.New("Invalid command: " + n)
+	}
+	if err := cmd.checkConfig(); err != nil {
+		return err
+	}
+	vs, err := url.ParseQuery(q)
+	if err != nil {
+		return errors.New("Query cannot be parsed")
+	}
+	for k := range vs {
+		if k == "" || (cmd.flagKey(k) == "" && cmd.GetArg(k) == nil) {
+			return errors.New("Flag " + k + " is not defined")
+		}
+	}
+
+	cfg, err := c.loadConfig(cmd)
+	if err != nil {
+		return err
+	}
+
+	c.cmd = cmd
+	if c.parsedFlags == nil {
+		c.parsedFlags = make(map[string]string)
+	}
+	if c.parsedArgs == nil {
+		c.parsedArgs = make(map[string]string)
+	}
+	cmd.sources = make(map[string]string)
+	cmd.counts = make(map[string]int)
+	for _, k := range cmd.GetSortedFlags() {
+		f := cmd.GetFlag(k)
+		// query values are passed to parseFlag like pointers of flagset, so repeated key is a duplicate as in argv
+		var np, ap interface{}
+		if f.name != "" {
+			if np, err = queryValue(f, vs[f.name]); err != nil {
+				return err
+			}
+			cmd.counts[k] += len(vs[f.name])
+		}
+		if f.alias != "" {
+			if ap, err = queryValue(f, vs[f.alias]); err != nil {
+				return err
+			}
+			cmd.counts[k] += len(vs[f.alias])
+		}
+		pv, err := c.parseFlag(cmd, k, np, ap, cmd.counts[k] > 0, cfg, false)
+		if err != nil {
+			return err
+		}
+		c.parsedFlags[k] = pv
+	}
+	if err := cmd.validateRelations(c.parsedFlags); err != nil {
+		return err
+	}
+	for _, k := range cmd.defaultsOrder() {
+		f := cmd.GetFlag(k)
+		if c.parsedFlags[k] != "" {
+			continue
+		}
+		v := f.defFn(c)
+		if err := f.ValidateValue(false, v, ""); err != nil {
+			return err
+		}
+		c.parsedFlags[k], _ = f.normalize(v)
+		cmd.sources[k] = "default"
+	}
+	for _, k := range cmd.GetSortedArgs() {
+		var err error
+		if c.parsedArgs[k], err = c.parseArg(cmd.GetArg(k), vs.Get(k), len(vs[k]) > 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryValue returns pointer to value of flag f from query values vs, of the same type as the one flagset would set. The last of many values is used, unless flag is repeatable.
+func queryValue(f *CLIFlag, vs []string) (interface{}, error) {
+	v := ""
+	if len(vs) > 0 {
+		v = vs[len(vs)-1]
+	}
+	if f.repeatable() {
+		v = strings.Join(vs, f.manySeparator())
+	}
+	if f.nflags&TypeBool > 0 {
+		b, ok := parseLooseBool(v)
+		if v == "" {
+			b, ok = len(vs) > 0, true
+		}
+		if !ok {
+			return nil, errors.New("Flag " + f.key() + " has invalid value")
+		}
+		return &b, nil
+	}
+	if f.nflags&TypeBoolLoose > 0 && v == "" && len(vs) > 0 {
+		v = "true"
+	}
+	return &v, nil
+}
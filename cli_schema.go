@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"encoding/json"
+)
+
+// schemaFlag describes flag or argument in the schema.
+type schemaFlag struct {
+	Name        string   `json:"name"`
+	Alias       string   `json:"alias,omitempty"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Many        bool     `json:"many,omitempty"`
+	HelpValue   string   `json:"help_value,omitempty"`
+	Description string   `json:"description"`
+	Env         string   `json:"env,omitempty"`
+	Default     string   `json:"default,omitempty"`
+	Requires    []string `json:"requires,omitempty"`
+	Secret      bool     `json:"secret,omitempty"`
+	Deprecated  bool     `json:"deprecated,omitempty"`
+	RemovedIn   string   `json:"removed_in,omitempty"`
+}
+
+// schemaVariadic describes variadic argument in the schema.
+type schemaVariadic struct {
+	schemaFlag
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// schemaCmd describes command in the schema.
+type schemaCmd struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Hidden      bool            `json:"hidden,omitempty"`
+	Flags       []schemaFlag    `json:"flags"`
+	Args        []schemaFlag    `json:"args"`
+	Variadic    *schemaVariadic `json:"variadic,omitempty"`
+	Exclusive   [][]string      `json:"exclusive,omitempty"`
+	ExactlyOne  [][]string      `json:"exactly_one,omitempty"`
+	SeeAlso     []string        `json:"see_also,omitempty"`
+}
+
+// schema describes the whole CLI.
+type schema struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Version     string      `json:"version"`
+	Commands    []schemaCmd `json:"commands"`
+}
+
+// Schema returns JSON description of all the commands with their flags, arguments and relationships between flags, eg. for generating client code.
+// Commands, flags and optional fields are always in the same order so that schemas of different versions can be compared.
+func (c *CLI) Schema() ([]byte, error) {
+	s := schema{Name: c.name, Description: c.desc, Version: c.Version(), Commands: []schemaCmd{}}
+	for _, n := range c.GetSortedCmds() {
+		cmd := c.GetCmd(n)
+		sc := schemaCmd{
+			Name:        n,
+			Description: cmd.desc,
+			Hidden:      cmd.hidden,
+			Flags:       []schemaFlag{},
+			Args:        []schemaFlag{},
+			Exclusive:   cmd.exclusive,
+			ExactlyOne:  cmd.exactlyOne,
+			SeeAlso:     cmd.seeAlso,
+		}
+		for _, fn := range cmd.GetSortedFlags() {
+			f := newSchemaFlag(cmd.GetFlag(fn))
+			f.Requires = cmd.flagRequires(fn)
+			sc.Flags = append(sc.Flags, f)
+		}
+		for i := 0; i < cmd.argsIdx; i++ {
+			sc.Args = append(sc.Args, newSchemaFlag(cmd.GetArg(cmd.argsOrder[i])))
+		}
+		if v := cmd.GetVariadicArg(); v != nil {
+			sc.Variadic = &schemaVariadic{schemaFlag: newSchemaFlag(v), Min: cmd.variadicMin, Max: cmd.variadicMax}
+			sc.Variadic.Required = cmd.variadicMin > 0
+		}
+		s.Commands = append(s.Commands, sc)
+	}
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// newSchemaFlag returns description of flag f in the schema.
+func newSchemaFlag(f *CLIFlag) schemaFlag {
+	sf := schemaFlag{
+		Name:        f.key(),
+		Alias:       f.alias,
+		Type:        f.Type(),
+		Required:    f.nflags&Required > 0,
+		Many:        f.nflags&AllowMany > 0,
+		HelpValue:   f.helpValue,
+		Description: f.desc,
+		Env:         f.env,
+		Secret:      f.nflags&Secret > 0,
+		Deprecated:  f.depr,
+		RemovedIn:   f.removeIn,
+	}
+	if f.defFn != nil {
+		sf.Default = "derived"
+	}
+	if f.name == "" {
+		sf.Alias = ""
+	}
+	return sf
+}
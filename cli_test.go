@@ -1,8 +1,15 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func h(c *CLI) int {
@@ -43,6 +50,18 @@ func createCLI() *CLI {
 	})
 	cmd5.AddArg("notrequired", "NOTREQUIRED", "Argument required when no -o", TypeString|Required)
 
+	cmd6 := c.AddCmd("short_and_long", "Flags with only name or only alias", h)
+	cmd6.AddFlag("", "s", "short", "Flag with alias only", TypeString|Required, nil)
+	cmd6.AddFlag("long", "", "long", "Flag with name only", TypeInt, nil)
+	cmd6.AddFlag("longer", "", "longer", "Another flag with name only", TypeInt, nil)
+	cmd6.AddFlag("second", "second-name", "second", "Flag with multi-character alias", TypeInt, nil)
+
+	cmd7 := c.AddCmd("schedule", "Schedule a job", h)
+	cmd7.AddFlag("at", "a", "HH:MM", "Time of day", TypeTimeOfDay|Required, nil)
+	cmd7.AddFlag("also", "", "HH:MM,...", "Additional times of day", TypeTimeOfDay|AllowMany, nil)
+	cmd7.AddFlag("tz", "", "zone", "Time zone", TypeTimezone, nil)
+	cmd7.AddFlag("notify-tz", "", "zone,...", "Time zones to notify", TypeTimezone|AllowMany, nil)
+
 	c.AddFlagToCmds("all", "x", "", "Flag added to all commands", TypeInt, nil)
 	c.AddArgToCmds("all", "ALL", "Arg added to all commands", TypeString)
 
@@ -60,6 +79,20 @@ func assertExitCode(t *testing.T, cli *CLI, a []string, c int) {
 	}
 }
 
+func runWithOutput(t *testing.T, cli *CLI, a []string) (int, string) {
+	os.Args = a
+	f, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	null, _ := os.Open("/dev/null")
+	defer null.Close()
+	code := cli.Run(f, null)
+	dat, _ := os.ReadFile(f.Name())
+	return code, string(dat)
+}
+
 func TestFlags(t *testing.T) {
 	c := createCLI()
 
@@ -90,10 +123,19 @@ func TestFlags(t *testing.T) {
 
 	t.Run("exit with code 1 when arg is missing", func(t *testing.T) {
 		assertExitCode(t, c, []string{"test", "play", "--level", "1", "-d", "4"}, 1)
-		assertExitCode(t, c, []string{"test", "play", "map", "4", "5", "--level", "1", "-d", "4"}, 1)
 		assertExitCode(t, c, []string{"test", "play", "-l", "1", "-d", "4", "winter"}, 1)
 	})
 
+	t.Run("exit with code 1 when flags follow args and flags must come first", func(t *testing.T) {
+		c.SetFlagsFirst(true)
+		defer c.SetFlagsFirst(false)
+		assertExitCode(t, c, []string{"test", "play", "map", "4", "5", "--level", "1", "-d", "4"}, 1)
+	})
+
+	t.Run("exit with code 0 when flags follow args by default", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "play", "map", "4", "5", "--level", "1", "-d", "4"}, 0)
+	})
+
 	t.Run("exit with code 1 when arg has invalid value", func(t *testing.T) {
 		assertExitCode(t, c, []string{"test", "play", "-l", "1", "-d", "4", "winter", "five"}, 1)
 	})
@@ -102,4 +144,2766 @@ func TestFlags(t *testing.T) {
 		assertExitCode(t, c, []string{"test", "overwrite_arg", "REQUIRED_ARG_HERE"}, 0)
 		assertExitCode(t, c, []string{"test", "overwrite_arg", "-o"}, 0)
 	})
+
+	t.Run("exit with code 0 when time of day is valid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "14:30"}, 0)
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "23:59:59"}, 0)
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "00:00", "--also", "08:15,12:00:30,18:45"}, 0)
+	})
+
+	t.Run("exit with code 1 when time of day is invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "25:00"}, 1)
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "14:60"}, 1)
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "9:30"}, 1)
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "09:30:5"}, 1)
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "14:30", "--also", "08:15,24:00"}, 1)
+	})
+
+	t.Run("exit with code 0 when time zone is valid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "14:30", "--tz", "Europe/Warsaw"}, 0)
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "14:30", "--notify-tz", "UTC,America/New_York"}, 0)
+	})
+
+	t.Run("exit with code 1 when time zone is invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "14:30", "--tz", "Europe/Nowhere"}, 1)
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "14:30", "--notify-tz", "UTC,,Asia/Tokyo"}, 1)
+		assertExitCode(t, c, []string{"test", "schedule", "--at", "14:30", "--tz", "Local"}, 1)
+	})
+
+	t.Run("exit with code 0 when flag with only name or only alias is passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "short_and_long", "-s", "value"}, 0)
+		assertExitCode(t, c, []string{"test", "short_and_long", "-s", "value", "--long", "1", "--longer", "2"}, 0)
+		assertExitCode(t, c, []string{"test", "short_and_long", "-s", "value", "--second-name", "3"}, 0)
+	})
+
+	t.Run("exit with code 1 when alias-only flag is missing", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "short_and_long", "--long", "1"}, 1)
+	})
+
+	t.Run("exit with code 1 when both name and multi-character alias are passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "short_and_long", "-s", "value", "--second", "3", "--second-name", "3"}, 1)
+	})
+}
+
+func TestHelpLine(t *testing.T) {
+	t.Run("bool flag has no value placeholder", func(t *testing.T) {
+		f := NewCLIFlag("verbose", "v", "", "Enable verbose logging", TypeBool, nil)
+		got := f.GetHelpLine()
+		want := "  -v,\t --verbose \tEnable verbose logging\n"
+		if got != want {
+			t.Errorf("got %q want %q\n", got, want)
+		}
+	})
+
+	t.Run("multi-character alias is printed as a second long name", func(t *testing.T) {
+		f := NewCLIFlag("verbose", "verb", "", "Enable verbose logging", TypeBool, nil)
+		got := f.GetHelpLine()
+		want := "  --verb,\t --verbose \tEnable verbose logging\n"
+		if got != want {
+			t.Errorf("got %q want %q\n", got, want)
+		}
+	})
+
+	t.Run("flag requiring value has value placeholder", func(t *testing.T) {
+		f := NewCLIFlag("level", "l", "int", "Starting level", TypeInt, nil)
+		got := f.GetHelpLine()
+		want := "  -l,\t --level int \tStarting level\n"
+		if got != want {
+			t.Errorf("got %q want %q\n", got, want)
+		}
+	})
+	t.Run("flag with environment variable has it printed", func(t *testing.T) {
+		f := NewCLIFlag("token", "", "TOKEN", "API token", TypeString, nil)
+		f.SetEnv("MYAPP_TOKEN")
+		got := f.GetHelpLine()
+		want := "  \t --token TOKEN \tAPI token [env: MYAPP_TOKEN]\n"
+		if got != want {
+			t.Errorf("got %q want %q\n", got, want)
+		}
+	})
+}
+
+func TestFlagInt(t *testing.T) {
+	var got int64
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("mask", "Apply a bitmask", func(c *CLI) int {
+		got = c.FlagInt("mask")
+		if c.Flag("bytes") != "" {
+			got = c.FlagInt("bytes")
+		}
+		return 0
+	})
+	cmd.AddFlag("mask", "m", "int", "Bitmask", TypeInt|AllowBasePrefix|Required, nil)
+	cmd.AddFlag("level", "l", "int", "Level", TypeInt, nil)
+	cmd.AddFlag("bytes", "b", "int", "Number of bytes", TypeInt|AllowDigitGrouping, nil)
+	cmd.AddFlag("ratio", "r", "float", "Ratio", TypeFloat|AllowDigitGrouping, nil).SetGroupingSeparator(" ")
+
+	t.Run("exit with code 0 and parse value with base prefix", func(t *testing.T) {
+		for v, want := range map[string]int64{"0x1F": 31, "0o17": 15, "0b1010": 10, "42": 42} {
+			assertExitCode(t, c, []string{"test", "mask", "-m", v}, 0)
+			if got != want {
+				t.Errorf("got %d want %d\n", got, want)
+			}
+		}
+	})
+
+	t.Run("exit with code 1 when value with base prefix is invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "mask", "-m", "0x1G"}, 1)
+		assertExitCode(t, c, []string{"test", "mask", "-m", "0b102"}, 1)
+	})
+
+	t.Run("exit with code 1 when base prefix is not allowed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "mask", "-m", "1", "-l", "0x1F"}, 1)
+	})
+
+	t.Run("exit with code 0 and remove digit grouping separator", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "mask", "-m", "1", "-b", "1_000_000"}, 0)
+		if got != 1000000 {
+			t.Errorf("got %d want %d\n", got, 1000000)
+		}
+		assertExitCode(t, c, []string{"test", "mask", "-m", "1", "-r", "1 000.25"}, 0)
+	})
+
+	t.Run("exit with code 1 when digit grouping is not allowed or separator is different", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "mask", "-m", "1", "-l", "1_000"}, 1)
+		assertExitCode(t, c, []string{"test", "mask", "-m", "1", "-r", "1_000.25"}, 1)
+	})
+
+	t.Run("exit with code 1 when digits are grouped incorrectly", func(t *testing.T) {
+		for _, v := range []string{"_1__0_", "1__000", "_1000", "1000_", "10_00", "1_0000", "-_100"} {
+			assertExitCode(t, c, []string{"test", "mask", "-m", "1", "-b", v}, 1)
+		}
+		assertExitCode(t, c, []string{"test", "mask", "-m", "1", "-r", "1 000.2 5"}, 1)
+		assertExitCode(t, c, []string{"test", "mask", "-m", "1_000"}, 1)
+		assertExitCode(t, c, []string{"test", "mask", "-m", "1", "-b", "-1_000"}, 0)
+	})
+
+	t.Run("exit with code 1 when integer is out of range", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "mask", "-m", "1", "-l", "99999999999999999999"}, 1)
+		assertExitCode(t, c, []string{"test", "mask", "-m", "0xFFFFFFFFFFFFFFFFFF"}, 1)
+
+		f := NewCLIFlag("level", "l", "int", "Level", TypeInt, nil)
+		err := f.ValidateValue(false, "99999999999999999999", "")
+		if err == nil || err.Error() != "Flag level is out of range" {
+			t.Errorf("got %v want out of range error\n", err)
+		}
+	})
+}
+
+func TestPreRun(t *testing.T) {
+	var calls []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("connect", "Connect to a database", func(c *CLI) int {
+		calls = append(calls, "handler")
+		return 0
+	})
+	cmd.AddFlag("fail", "f", "", "Make pre-run fail", TypeBool, nil)
+	cmd.AddFlag("dsn", "d", "dsn", "Data source name", TypeString|Required, nil)
+	cmd.AddPreRun(func(c *CLI) error {
+		calls = append(calls, "prerun")
+		if c.Flag("fail") == "true" {
+			return errors.New("cannot connect")
+		}
+		return nil
+	})
+	c.AddPreRun(func(c *CLI) error {
+		calls = append(calls, "global")
+		if c.Flag("dsn") == "global-fail" {
+			return errors.New("cannot read config")
+		}
+		return nil
+	})
+
+	t.Run("exit with code 0 and run pre-run before handler", func(t *testing.T) {
+		calls = nil
+		assertExitCode(t, c, []string{"test", "connect", "-d", "db"}, 0)
+		if strings.Join(calls, ",") != "global,prerun,handler" {
+			t.Errorf("got %v want [global prerun handler]\n", calls)
+		}
+	})
+
+	t.Run("exit with code 1 and skip handler when pre-run fails", func(t *testing.T) {
+		calls = nil
+		assertExitCode(t, c, []string{"test", "connect", "-d", "db", "-f"}, 1)
+		if strings.Join(calls, ",") != "global,prerun" {
+			t.Errorf("got %v want [global prerun]\n", calls)
+		}
+	})
+
+	t.Run("exit with code 1 and skip command when global pre-run fails", func(t *testing.T) {
+		calls = nil
+		assertExitCode(t, c, []string{"test", "connect", "-d", "global-fail"}, 1)
+		if strings.Join(calls, ",") != "global" {
+			t.Errorf("got %v want [global]\n", calls)
+		}
+	})
+
+	t.Run("exit with code 1 and skip pre-run when validation fails", func(t *testing.T) {
+		calls = nil
+		assertExitCode(t, c, []string{"test", "connect"}, 1)
+		if len(calls) != 0 {
+			t.Errorf("got %v want []\n", calls)
+		}
+	})
+}
+
+func TestBoolLoose(t *testing.T) {
+	var got string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("run", "Run with a feature", func(c *CLI) int {
+		got = c.Flag("feature")
+		return 0
+	})
+	cmd.AddFlag("feature", "f", "BOOL", "Enable feature", TypeBoolLoose, nil)
+	cmd.AddArg("name", "NAME", "Name", TypeString)
+
+	t.Run("exit with code 0 and parse explicit and missing values", func(t *testing.T) {
+		for _, tc := range []struct {
+			args []string
+			want string
+		}{
+			{[]string{"test", "run"}, "false"},
+			{[]string{"test", "run", "--feature"}, "true"},
+			{[]string{"test", "run", "--feature=yes"}, "true"},
+			{[]string{"test", "run", "--feature=off"}, "false"},
+			{[]string{"test", "run", "--feature", "no"}, "false"},
+			{[]string{"test", "run", "-f", "1"}, "true"},
+			{[]string{"test", "run", "-f", "name"}, "true"},
+		} {
+			assertExitCode(t, c, tc.args, 0)
+			if got != tc.want {
+				t.Errorf("%v: got %s want %s\n", tc.args, got, tc.want)
+			}
+		}
+	})
+
+	t.Run("exit with code 1 when value is not a boolean", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "run", "--feature=maybe"}, 1)
+	})
+}
+
+func TestEnv(t *testing.T) {
+	var got map[string]string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("run", "Run with settings from environment", func(c *CLI) int {
+		got = map[string]string{"verbose": c.Flag("verbose"), "level": c.Flag("level")}
+		return 0
+	})
+	cmd.AddFlag("verbose", "v", "", "Verbose mode", TypeBool, nil).SetEnv("TEST_CLI_VERBOSE")
+	cmd.AddFlag("level", "l", "int", "Level", TypeInt|Required, nil).SetEnv("TEST_CLI_LEVEL")
+
+	t.Run("exit with code 0 and read values from environment", func(t *testing.T) {
+		for v, want := range map[string]string{"true": "true", "1": "true", "yes": "true", "no": "false", "0": "false", "off": "false"} {
+			t.Setenv("TEST_CLI_VERBOSE", v)
+			t.Setenv("TEST_CLI_LEVEL", "3")
+			assertExitCode(t, c, []string{"test", "run"}, 0)
+			if got["verbose"] != want || got["level"] != "3" {
+				t.Errorf("%s: got %v want verbose %s and level 3\n", v, got, want)
+			}
+		}
+	})
+
+	t.Run("exit with code 0 and prefer passed flags over environment", func(t *testing.T) {
+		t.Setenv("TEST_CLI_VERBOSE", "yes")
+		t.Setenv("TEST_CLI_LEVEL", "3")
+		assertExitCode(t, c, []string{"test", "run", "--verbose=false", "-l", "5"}, 0)
+		if got["verbose"] != "false" || got["level"] != "5" {
+			t.Errorf("got %v want verbose false and level 5\n", got)
+		}
+	})
+
+	t.Run("exit with code 1 when value from environment is invalid", func(t *testing.T) {
+		t.Setenv("TEST_CLI_LEVEL", "3")
+		t.Setenv("TEST_CLI_VERBOSE", "maybe")
+		assertExitCode(t, c, []string{"test", "run"}, 1)
+		t.Setenv("TEST_CLI_VERBOSE", "")
+		t.Setenv("TEST_CLI_LEVEL", "three")
+		assertExitCode(t, c, []string{"test", "run"}, 1)
+	})
+}
+
+func TestPassthrough(t *testing.T) {
+	var got []string
+	var gotArgs []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("wrap", "Wrap another tool", func(c *CLI) int {
+		got = c.Passthrough()
+		gotArgs = []string{c.Flag("name"), c.Arg("file")}
+		return 0
+	})
+	cmd.AddFlag("name", "n", "name", "Name", TypeString|Required, nil)
+	cmd.AddArg("file", "FILE", "File", TypeString)
+	cmd.SetPassthrough(true)
+
+	t.Run("exit with code 0 and collect undefined flags", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "wrap", "--color=always", "-q", "-n", "x", "file.txt"}, 0)
+		if strings.Join(got, " ") != "--color=always -q" {
+			t.Errorf("got %v want [--color=always -q]\n", got)
+		}
+		if gotArgs[0] != "x" || gotArgs[1] != "file.txt" {
+			t.Errorf("got %v want [x file.txt]\n", gotArgs)
+		}
+	})
+
+	t.Run("exit with code 0 and collect undefined flags with values after space", func(t *testing.T) {
+		cmd.SetPassthroughValueFlags("color")
+		defer cmd.SetPassthroughValueFlags()
+		assertExitCode(t, c, []string{"test", "wrap", "--color", "always", "-n", "x", "--dry-run", "file.txt"}, 0)
+		if strings.Join(got, " ") != "--color always --dry-run" {
+			t.Errorf("got %v want [--color always --dry-run]\n", got)
+		}
+		if gotArgs[0] != "x" || gotArgs[1] != "file.txt" {
+			t.Errorf("got %v want [x file.txt]\n", gotArgs)
+		}
+	})
+
+	t.Run("exit with code 1 when value of undefined flag after space is an unexpected argument", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "wrap", "--color", "always", "-n", "x", "file.txt"}, 1)
+	})
+
+	t.Run("exit with code 1 when defined flags are invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "wrap", "--color=always"}, 1)
+	})
+}
+
+func TestArgs(t *testing.T) {
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("copy", "Copy a file", func(c *CLI) int {
+		got = []string{c.Arg("src"), c.Arg("dst"), c.Arg("mode")}
+		return 0
+	})
+	cmd.AddArg("src", "SRC", "Source file", TypePathRegularFile|Required)
+	cmd.AddArg("dst", "DST", "Destination", TypeString|Required)
+	c.AddArgToCmds("mode", "MODE", "File mode", TypeInt)
+
+	t.Run("exit with code 0 and get positional arguments by name", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "copy", "cli_test.go", "dst.go", "644"}, 0)
+		if strings.Join(got, " ") != "cli_test.go dst.go 644" {
+			t.Errorf("got %v want [cli_test.go dst.go 644]\n", got)
+		}
+	})
+
+	t.Run("exit with code 1 when positional argument is missing or invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "copy", "cli_test.go"}, 1)
+		assertExitCode(t, c, []string{"test", "copy", "nonexistingfile", "dst.go"}, 1)
+		assertExitCode(t, c, []string{"test", "copy", ".", "dst.go"}, 1)
+		assertExitCode(t, c, []string{"test", "copy", "cli_test.go", "dst.go", "rw"}, 1)
+	})
+}
+
+func TestVariadicArg(t *testing.T) {
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("rm", "Remove files", func(c *CLI) int {
+		got = append([]string{c.Arg("mode")}, c.VariadicArg("files")...)
+		return 0
+	})
+	cmd.AddArg("mode", "MODE", "Mode", TypeAlphanumeric|Required)
+	cmd.AddVariadicArg("files", "FILE", "Files to remove", TypePathRegularFile|Required, 0, 2)
+
+	t.Run("exit with code 0 and get variadic values", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "rm", "force", "cli.go", "cli_test.go"}, 0)
+		if strings.Join(got, " ") != "force cli.go cli_test.go" {
+			t.Errorf("got %v want [force cli.go cli_test.go]\n", got)
+		}
+	})
+
+	t.Run("exit with code 1 when number of variadic values is out of bounds", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "rm", "force"}, 1)
+		assertExitCode(t, c, []string{"test", "rm", "force", "cli.go", "cli_cmd.go", "cli_flag.go"}, 1)
+	})
+
+	t.Run("exit with code 1 when variadic value is invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "rm", "force", "cli.go", "nonexistingfile"}, 1)
+	})
+
+	t.Run("variadic argument is shown in usage", func(t *testing.T) {
+		got := cmd.getArgsHelpLine()
+		if got != " MODE FILE..." {
+			t.Errorf("got %q want %q\n", got, " MODE FILE...")
+		}
+	})
+}
+
+func TestFlagRelations(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("serve", "Serve the application", h)
+	cmd.AddFlag("tls-cert", "", "file", "TLS certificate", TypePathFile, nil)
+	cmd.AddFlag("tls-key", "", "file", "TLS key", TypePathFile, nil)
+	cmd.AddFlag("quiet", "q", "", "Quiet mode", TypeBool, nil)
+	cmd.AddFlag("verbose", "v", "", "Verbose mode", TypeBool, nil)
+	cmd.AddFlagRequires("tls-cert", "tls-key")
+	cmd.AddExclusiveFlags("quiet", "verbose")
+
+	t.Run("exit with code 0 when relations are satisfied", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "serve"}, 0)
+		assertExitCode(t, c, []string{"test", "serve", "--tls-cert", "cli.go", "--tls-key", "cli.go", "-q"}, 0)
+		assertExitCode(t, c, []string{"test", "serve", "--tls-key", "cli.go", "-v"}, 0)
+	})
+
+	t.Run("exit with code 1 when required flag is missing or exclusive flags are passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "serve", "--tls-cert", "cli.go"}, 1)
+		assertExitCode(t, c, []string{"test", "serve", "-q", "-v"}, 1)
+	})
+
+	t.Run("relations are shown in help", func(t *testing.T) {
+		got := cmd.annotateHelpLine("tls-cert", cmd.GetFlag("tls-cert").GetHelpLine())
+		want := "  \t --tls-cert file \tTLS certificate (requires --tls-key)\n"
+		if got != want {
+			t.Errorf("got %q want %q\n", got, want)
+		}
+		got = cmd.annotateHelpLine("quiet", cmd.GetFlag("quiet").GetHelpLine())
+		want = "  -q,\t --quiet \tQuiet mode (cannot be used with --verbose)\n"
+		if got != want {
+			t.Errorf("got %q want %q\n", got, want)
+		}
+	})
+}
+
+func TestNormalizePath(t *testing.T) {
+	var got string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("read", "Read a file", func(c *CLI) int {
+		got = c.Flag("file")
+		return 0
+	})
+	cmd.AddFlag("file", "f", "file", "File", TypePathRegularFile|NormalizePath|Required, nil)
+	cmd.AddFlag("raw", "r", "file", "File without normalization", TypePathRegularFile, nil)
+
+	t.Run("exit with code 0 and pass normalized path", func(t *testing.T) {
+		want := filepath.Join(".", "cli_test.go")
+		for _, v := range []string{"./cli_test.go", ".\\cli_test.go", "a/../cli_test.go"} {
+			assertExitCode(t, c, []string{"test", "read", "-f", v}, 0)
+			if got != want {
+				t.Errorf("%s: got %s want %s\n", v, got, want)
+			}
+		}
+	})
+
+	t.Run("exit with code 1 when path is not normalized", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "read", "-f", "cli_test.go", "-r", ".\\cli_test.go"}, 1)
+	})
+}
+
+func TestExpandHome(t *testing.T) {
+	var got string
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.Mkdir(filepath.Join(home, "config"), 0755)
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("load", "Load configuration", func(c *CLI) int {
+		got = c.Flag("dir")
+		return 0
+	})
+	cmd.AddFlag("dir", "d", "dir", "Directory", TypePathDir|ExpandHome|Required, nil)
+	cmd.AddFlag("raw", "r", "dir", "Directory without expanding", TypePathDir, nil)
+
+	t.Run("exit with code 0 and pass expanded path", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "load", "-d", "~/config"}, 0)
+		if got != filepath.Join(home, "config") {
+			t.Errorf("got %s want %s\n", got, filepath.Join(home, "config"))
+		}
+		assertExitCode(t, c, []string{"test", "load", "-d", "~"}, 0)
+		if got != home {
+			t.Errorf("got %s want %s\n", got, home)
+		}
+	})
+
+	t.Run("exit with code 1 when home is not expanded", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "load", "-d", "~", "-r", "~/config"}, 1)
+		assertExitCode(t, c, []string{"test", "load", "-d", "~config"}, 1)
+	})
+}
+
+func TestSymlinks(t *testing.T) {
+	var got string
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	os.WriteFile(target, []byte("x"), 0644)
+	os.Symlink(target, filepath.Join(dir, "link.txt"))
+	os.Symlink(filepath.Join(dir, "missing.txt"), filepath.Join(dir, "broken.txt"))
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("read", "Read a file", func(c *CLI) int {
+		got = c.Flag("resolved")
+		return 0
+	})
+	cmd.AddFlag("resolved", "r", "file", "File with symbolic links resolved", TypePathFile|ResolveSymlinks, nil)
+	cmd.AddFlag("nofollow", "n", "file", "File that cannot be a symbolic link", TypePathFile|NoFollowSymlinks, nil)
+
+	t.Run("exit with code 0 and pass resolved path", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "read", "-r", filepath.Join(dir, "link.txt")}, 0)
+		want, _ := filepath.EvalSymlinks(target)
+		if got != want {
+			t.Errorf("got %s want %s\n", got, want)
+		}
+		assertExitCode(t, c, []string{"test", "read", "-n", target}, 0)
+	})
+
+	t.Run("exit with code 1 when symbolic link is broken or not allowed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "read", "-r", filepath.Join(dir, "broken.txt")}, 1)
+		assertExitCode(t, c, []string{"test", "read", "-n", filepath.Join(dir, "link.txt")}, 1)
+	})
+}
+
+func TestOptionalTypedValue(t *testing.T) {
+	types := map[string]int64{
+		"string":          TypeString,
+		"path file":       TypePathFile,
+		"regular file":    TypePathRegularFile,
+		"json file":       TypePathRegularFile | ValidJSON,
+		"dir":             TypePathDir,
+		"int":             TypeInt,
+		"many ints":       TypeInt | AllowMany,
+		"int with prefix": TypeInt | AllowBasePrefix,
+		"float":           TypeFloat,
+		"alphanumeric":    TypeAlphanumeric | AllowDots,
+		"email":           TypeEmail,
+		"fqdn":            TypeFQDN,
+		"time of day":     TypeTimeOfDay,
+		"time zone":       TypeTimezone | AllowMany,
+		"loose bool":      TypeBoolLoose,
+	}
+
+	t.Run("empty value of optional flag is valid", func(t *testing.T) {
+		for n, nf := range types {
+			f := NewCLIFlag("opt", "o", "value", "Optional flag", nf, nil)
+			if err := f.ValidateValue(false, "", ""); err != nil {
+				t.Errorf("%s: got %v want nil\n", n, err)
+			}
+		}
+	})
+
+	t.Run("empty value of required flag is invalid", func(t *testing.T) {
+		for n, nf := range types {
+			if nf&TypeBoolLoose > 0 {
+				continue
+			}
+			f := NewCLIFlag("req", "r", "value", "Required flag", nf|Required, nil)
+			if err := f.ValidateValue(false, "", ""); err == nil {
+				t.Errorf("%s: got nil want error\n", n)
+			}
+		}
+	})
+}
+
+func TestEmailAndFQDN(t *testing.T) {
+	email := NewCLIFlag("email", "e", "email", "Email", TypeEmail|AllowMany, nil)
+	fqdn := NewCLIFlag("host", "h", "fqdn", "Host", TypeFQDN, nil)
+
+	t.Run("valid values pass", func(t *testing.T) {
+		for _, v := range []string{"a@example.com", "first.last+tag@sub.example.org", "a@example.com,b@localhost"} {
+			if err := email.ValidateValue(false, v, ""); err != nil {
+				t.Errorf("%s: got %v want nil\n", v, err)
+			}
+		}
+		for _, v := range []string{"example.com", "sub.example.com.", "a-b.c1.io"} {
+			if err := fqdn.ValidateValue(false, v, ""); err != nil {
+				t.Errorf("%s: got %v want nil\n", v, err)
+			}
+		}
+	})
+
+	t.Run("invalid values fail", func(t *testing.T) {
+		for _, v := range []string{"example.com", "a@", "a@-example.com", "a@example.com,"} {
+			if err := email.ValidateValue(false, v, ""); err == nil {
+				t.Errorf("%s: got nil want error\n", v)
+			}
+		}
+		for _, v := range []string{"localhost", "-a.example.com", "a..example.com", "a_b.example.com"} {
+			if err := fqdn.ValidateValue(false, v, ""); err == nil {
+				t.Errorf("%s: got nil want error\n", v)
+			}
+		}
+	})
+}
+
+func TestText(t *testing.T) {
+	var got string
+	dir := t.TempDir()
+	msg := filepath.Join(dir, "msg.txt")
+	os.WriteFile(msg, []byte("Subject\n\nBody of the message\n"), 0644)
+	stdin := filepath.Join(dir, "stdin.txt")
+	os.WriteFile(stdin, []byte("From stdin\n"), 0644)
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("commit", "Commit changes", func(c *CLI) int {
+		got = c.Flag("message")
+		return 0
+	})
+	cmd.AddFlag("message", "m", "text", "Message", TypeText|Required, nil).SetLengthRange(3, 40)
+
+	t.Run("exit with code 0 and read text from value, file or stdin", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "commit", "-m", "Inline message"}, 0)
+		if got != "Inline message" {
+			t.Errorf("got %q want %q\n", got, "Inline message")
+		}
+		assertExitCode(t, c, []string{"test", "commit", "-m", "@" + msg}, 0)
+		if got != "Subject\n\nBody of the message\n" {
+			t.Errorf("got %q want file contents\n", got)
+		}
+		assertExitCode(t, c, []string{"test", "commit", "-m", "@@handle"}, 0)
+		if got != "@handle" {
+			t.Errorf("got %q want %q\n", got, "@handle")
+		}
+		f, _ := os.Open(stdin)
+		defer f.Close()
+		c.SetStdin(f)
+		assertExitCode(t, c, []string{"test", "commit", "-m", "-"}, 0)
+		if got != "From stdin\n" {
+			t.Errorf("got %q want stdin contents\n", got)
+		}
+	})
+
+	t.Run("exit with code 1 when file is missing or length is out of range", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "commit", "-m", "@" + filepath.Join(dir, "missing.txt")}, 1)
+		assertExitCode(t, c, []string{"test", "commit", "-m", "ab"}, 1)
+		assertExitCode(t, c, []string{"test", "commit", "-m", strings.Repeat("a", 41)}, 1)
+	})
+}
+
+func TestValueWithDashes(t *testing.T) {
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("grep", "Search for a pattern", func(c *CLI) int {
+		got = []string{c.Flag("offset"), c.Flag("pattern")}
+		return 0
+	})
+	cmd.AddFlag("offset", "o", "offset", "Offset", TypeString, nil)
+	cmd.AddFlag("pattern", "p", "pattern", "Pattern", TypeString, nil)
+	cmd.AddFlag("line", "l", "int", "Line", TypeInt, nil)
+	cmd.AddFlag("shift", "s", "float,...", "Shifts", TypeFloat|AllowMany, nil)
+
+	t.Run("exit with code 0 and take value after equal sign verbatim", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "grep", "--offset=-5", "--pattern=--foo"}, 0)
+		if got[0] != "-5" || got[1] != "--foo" {
+			t.Errorf("got %v want [-5 --foo]\n", got)
+		}
+		assertExitCode(t, c, []string{"test", "grep", "-p=-x=1", "-o", "--"}, 0)
+		if got[0] != "--" || got[1] != "-x=1" {
+			t.Errorf("got %v want [-- -x=1]\n", got)
+		}
+	})
+
+	t.Run("exit with code 0 when numeric flag has negative value", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "grep", "--line", "-5"}, 0)
+		assertExitCode(t, c, []string{"test", "grep", "-l", "-5", "-s", "-1.5,2.0"}, 0)
+		assertExitCode(t, c, []string{"test", "grep", "--line=-5", "--shift=-0.25"}, 0)
+	})
+
+	t.Run("exit with code 1 when negative value is invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "grep", "--line", "--5"}, 1)
+		assertExitCode(t, c, []string{"test", "grep", "--line", "5-"}, 1)
+		assertExitCode(t, c, []string{"test", "grep", "-s", "-1.5,-"}, 1)
+	})
+}
+
+func TestFlagsIntrospection(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("verbose", "v", "", "Verbose mode", TypeBool, nil)
+	cmd.AddFlag("username", "u", "username", "Username", TypeAlphanumeric|AllowDots|Required, nil)
+	cmd.AddFlag("config", "", "file", "Config file", TypePathRegularFile|ValidJSON, nil)
+
+	got := []string{}
+	for _, f := range cmd.Flags() {
+		got = append(got, strings.Join([]string{f.Name(), f.Alias(), f.HelpValue(), f.Desc(), f.Type()}, "|"))
+	}
+	want := []string{
+		"config||file|Config file|file",
+		"username|u|username|Username|alphanumeric",
+		"verbose|v||Verbose mode|bool",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %v want %v\n", got, want)
+	}
+	if nf := cmd.GetFlag("username").Flags(); nf != TypeAlphanumeric|AllowDots|Required {
+		t.Errorf("got %d want %d\n", nf, TypeAlphanumeric|AllowDots|Required)
+	}
+}
+
+func TestArgFiles(t *testing.T) {
+	var got []string
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "cmd.txt"), []byte("build --name 'my project'\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "opts.txt"), []byte("--level 3\n@"+filepath.Join(dir, "nested.txt")+"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "nested.txt"), []byte("\"target dir\"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "loop.txt"), []byte("@"+filepath.Join(dir, "loop.txt")), 0644)
+	os.WriteFile(filepath.Join(dir, "quote.txt"), []byte("--name 'unterminated"), 0644)
+	os.WriteFile(filepath.Join(dir, "comments.txt"), []byte("# build options\n\n--name \"a # b\" # inline comment\n  # indented comment\n--message \\#tag\n"), 0644)
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.SetArgFiles(true)
+	cmd := c.AddCmd("build", "Build the project", func(c *CLI) int {
+		got = []string{c.Flag("name"), c.Flag("level"), c.Flag("message"), c.Arg("target")}
+		return 0
+	})
+	cmd.AddFlag("name", "n", "name", "Name", TypeString, nil)
+	cmd.AddFlag("level", "l", "int", "Level", TypeInt, nil)
+	cmd.AddFlag("message", "m", "text", "Message", TypeString, nil)
+	cmd.AddArg("target", "TARGET", "Target", TypeString)
+
+	t.Run("exit with code 0 and insert arguments from files", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "@" + filepath.Join(dir, "cmd.txt"), "@" + filepath.Join(dir, "opts.txt")}, 0)
+		want := "my project|3||target dir"
+		if strings.Join(got, "|") != want {
+			t.Errorf("got %q want %q\n", strings.Join(got, "|"), want)
+		}
+	})
+
+	t.Run("exit with code 0 and keep flag value starting with @", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "build", "-m", "@someone", "--", "@target"}, 0)
+		if got[2] != "@someone" || got[3] != "@target" {
+			t.Errorf("got %v want message @someone and target @target\n", got)
+		}
+	})
+
+	t.Run("exit with code 0 and skip comments and blank lines", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "build", "@" + filepath.Join(dir, "comments.txt")}, 0)
+		if got[0] != "a # b" || got[2] != "#tag" {
+			t.Errorf("got %v want name 'a # b' and message #tag\n", got)
+		}
+	})
+
+	t.Run("exit with code 1 when argument file is invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "build", "@" + filepath.Join(dir, "missing.txt")}, 1)
+		assertExitCode(t, c, []string{"test", "build", "@" + filepath.Join(dir, "loop.txt")}, 1)
+		assertExitCode(t, c, []string{"test", "@" + filepath.Join(dir, "loop.txt")}, 1)
+		assertExitCode(t, c, []string{"test", "build", "@" + filepath.Join(dir, "quote.txt")}, 1)
+	})
+}
+
+func TestUnknownFlags(t *testing.T) {
+	var got string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	strict := c.AddCmd("strict", "Fail on undefined flags", h)
+	strict.AddFlag("name", "n", "name", "Name", TypeString, nil)
+	loose := c.AddCmd("loose", "Ignore undefined flags", func(c *CLI) int {
+		got = c.Flag("name") + "|" + strings.Join(c.Passthrough(), " ")
+		return 0
+	})
+	loose.AddFlag("name", "n", "name", "Name", TypeString, nil)
+	loose.SetIgnoreUnknown(true)
+
+	t.Run("exit with code 1 when flag is undefined or has no value", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "strict", "--new-flag", "-n", "x"}, 1)
+		assertExitCode(t, c, []string{"test", "strict", "-n"}, 1)
+	})
+
+	t.Run("exit with code 0 and skip undefined flags", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "loose", "--new-flag", "-n", "x", "--other=1"}, 0)
+		if got != "x|" {
+			t.Errorf("got %q want %q\n", got, "x|")
+		}
+	})
+
+	t.Run("exit with code 1 when there are too many arguments", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "loose", "--new-flag", "-n", "x", "extra"}, 1)
+	})
+
+	t.Run("exit with code 0 and collect undefined flags when passthrough is set as well", func(t *testing.T) {
+		loose.SetPassthrough(true)
+		defer loose.SetPassthrough(false)
+		assertExitCode(t, c, []string{"test", "loose", "--new-flag", "-n", "x"}, 0)
+		if got != "x|--new-flag" {
+			t.Errorf("got %q want %q\n", got, "x|--new-flag")
+		}
+	})
+}
+
+func TestAlphanumeric(t *testing.T) {
+	req := NewCLIFlag("users", "u", "user,...", "Users", TypeAlphanumeric|AllowMany|Required, nil)
+	req.SetLengthRange(3, 8)
+	opt := NewCLIFlag("tags", "t", "tag,...", "Tags", TypeAlphanumeric|AllowMany, nil)
+
+	t.Run("empty required value is missing and empty optional value is valid", func(t *testing.T) {
+		err := req.ValidateValue(false, "", "")
+		if err == nil || err.Error() != "Flag users is missing" {
+			t.Errorf("got %v want missing error\n", err)
+		}
+		if err := opt.ValidateValue(false, "", ""); err != nil {
+			t.Errorf("got %v want nil\n", err)
+		}
+	})
+
+	t.Run("each value has its length checked", func(t *testing.T) {
+		if err := req.ValidateValue(false, "abc,abcdefgh", ""); err != nil {
+			t.Errorf("got %v want nil\n", err)
+		}
+		err := req.ValidateValue(false, "abc,ab", "")
+		if err == nil || err.Error() != "Flag users must have at least 3 characters" {
+			t.Errorf("got %v want length error\n", err)
+		}
+		err = req.ValidateValue(false, "abcdefghi", "")
+		if err == nil || err.Error() != "Flag users must have at most 8 characters" {
+			t.Errorf("got %v want length error\n", err)
+		}
+	})
+
+	t.Run("pattern of many values is anchored", func(t *testing.T) {
+		for _, v := range []string{"abc,", ",abc", "abc,,abc", "abc def", "abc,de-f"} {
+			if err := opt.ValidateValue(false, v, ""); err == nil {
+				t.Errorf("%q: got nil want error\n", v)
+			}
+		}
+	})
+}
+
+func TestAllowSpace(t *testing.T) {
+	f := NewCLIFlag("names", "n", "name,...", "Display names", TypeAlphanumeric|AllowSpace|AllowDots|AllowMany, nil)
+
+	t.Run("values with spaces are valid", func(t *testing.T) {
+		for _, v := range []string{"John Doe", "John Doe,Jane A. Doe", "single"} {
+			if err := f.ValidateValue(false, v, ""); err != nil {
+				t.Errorf("%q: got %v want nil\n", v, err)
+			}
+		}
+	})
+
+	t.Run("spaces are not allowed without modifier", func(t *testing.T) {
+		f := NewCLIFlag("name", "n", "name", "Name", TypeAlphanumeric|AllowDots, nil)
+		if err := f.ValidateValue(false, "John Doe", ""); err == nil {
+			t.Errorf("got nil want error\n")
+		}
+	})
+}
+
+func TestAlphanumericAllowCombinations(t *testing.T) {
+	mods := []struct {
+		nf int64
+		c  string
+	}{
+		{AllowUnderscore, "_"},
+		{AllowDots, "."},
+		{AllowHyphen, "-"},
+		{AllowSpace, " "},
+	}
+	// every subset of the modifiers
+	for i := 0; i < 1<<len(mods); i++ {
+		nf := int64(TypeAlphanumeric)
+		allowed := ""
+		for j, m := range mods {
+			if i&(1<<j) > 0 {
+				nf |= m.nf
+				allowed += m.c
+			}
+		}
+		f := NewCLIFlag("anum", "a", "anum", "Alphanumeric", nf, nil)
+		for _, m := range mods {
+			v := "ab" + m.c + "12"
+			err := f.ValidateValue(false, v, "")
+			if strings.Contains(allowed, m.c) && err != nil {
+				t.Errorf("allowed %q: %q got %v want nil\n", allowed, v, err)
+			}
+			if !strings.Contains(allowed, m.c) && err == nil {
+				t.Errorf("allowed %q: %q got nil want error\n", allowed, v)
+			}
+		}
+		if err := f.ValidateValue(false, "ab12", ""); err != nil {
+			t.Errorf("allowed %q: got %v want nil\n", allowed, err)
+		}
+		if err := f.ValidateValue(false, "ab/12", ""); err == nil {
+			t.Errorf("allowed %q: got nil want error\n", allowed)
+		}
+	}
+}
+
+func TestPattern(t *testing.T) {
+	for _, tc := range []struct {
+		nf   int64
+		want string
+	}{
+		{TypeInt, "^-?[0-9]+$"},
+		{TypeFloat | AllowMany | ManySeparatorSemiColon, "^-?[0-9]{1,16}\\.[0-9]{1,16}(;-?[0-9]{1,16}\\.[0-9]{1,16})*$"},
+		{TypeAlphanumeric, "^[0-9a-zA-Z]+$"},
+		{TypeAlphanumeric | AllowHyphen | AllowDots, "^[0-9a-zA-Z\\.\\-]+$"},
+		{TypeAlphanumeric | AllowUnderscore | AllowMany | ManySeparatorColon, "^[0-9a-zA-Z_]+(:[0-9a-zA-Z_]+)*$"},
+	} {
+		f := NewCLIFlag("flag", "f", "value", "Flag", tc.nf, nil)
+		if got := f.Pattern(); got != tc.want {
+			t.Errorf("got %q want %q\n", got, tc.want)
+		}
+	}
+}
+
+func TestCustomPattern(t *testing.T) {
+	anchored := NewCLIFlag("code", "c", "code", "Code", TypeString, nil)
+	anchored.SetPattern("[A-Z]{3}-[0-9]+")
+	substring := NewCLIFlag("grep", "g", "text", "Text containing foo", TypeString|PatternSubstring, nil)
+	substring.SetPattern("foo")
+
+	t.Run("anchored pattern has to match the whole value", func(t *testing.T) {
+		if err := anchored.ValidateValue(false, "ABC-123", ""); err != nil {
+			t.Errorf("got %v want nil\n", err)
+		}
+		if err := anchored.ValidateValue(false, "xABC-123", ""); err == nil {
+			t.Errorf("got nil want error\n")
+		}
+	})
+
+	t.Run("substring pattern can match anywhere", func(t *testing.T) {
+		if err := substring.ValidateValue(false, "a foo b", ""); err != nil {
+			t.Errorf("got %v want nil\n", err)
+		}
+		if err := substring.ValidateValue(false, "bar", ""); err == nil {
+			t.Errorf("got nil want error\n")
+		}
+		if err := substring.ValidateValue(false, "", ""); err != nil {
+			t.Errorf("got %v want nil\n", err)
+		}
+	})
+}
+
+func TestIPRange(t *testing.T) {
+	f := NewCLIFlag("allow", "a", "ip-ip,...", "Allowed ranges", TypeIPRange|AllowMany, nil)
+
+	t.Run("valid ranges pass", func(t *testing.T) {
+		for _, v := range []string{"10.0.0.1-10.0.0.50", "10.0.0.1-10.0.0.1", "192.168.0.1-192.168.0.9,10.0.0.1-10.0.1.0", "fd00::1-fd00::ff"} {
+			if err := f.ValidateValue(false, v, ""); err != nil {
+				t.Errorf("%s: got %v want nil\n", v, err)
+			}
+		}
+	})
+
+	t.Run("invalid ranges fail", func(t *testing.T) {
+		for _, v := range []string{"10.0.0.50-10.0.0.1", "10.0.0.1", "10.0.0.1-fd00::1", "10.0.0.1-10.0.0.2-10.0.0.3", "10.0.0.256-10.0.1.0", "10.0.0.1-10.0.0.2,"} {
+			if err := f.ValidateValue(false, v, ""); err == nil {
+				t.Errorf("%s: got nil want error\n", v)
+			}
+		}
+	})
+}
+
+func TestLowercaseDomain(t *testing.T) {
+	var got string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("invite", "Invite users", func(c *CLI) int {
+		got = c.Flag("email")
+		return 0
+	})
+	cmd.AddFlag("email", "e", "email,...", "Emails", TypeEmail|AllowMany|LowercaseDomain|Required, nil)
+
+	assertExitCode(t, c, []string{"test", "invite", "-e", "John.Doe@Example.COM,jane@EXAMPLE.org"}, 0)
+	if got != "John.Doe@example.com,jane@example.org" {
+		t.Errorf("got %s want %s\n", got, "John.Doe@example.com,jane@example.org")
+	}
+}
+
+func TestMustResolve(t *testing.T) {
+	defer func(fn func(context.Context, string) ([]string, error)) { lookupHost = fn }(lookupHost)
+	lookupHost = func(ctx context.Context, h string) ([]string, error) {
+		if h == "known.example.com" {
+			return []string{"192.0.2.1"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	f := NewCLIFlag("host", "h", "fqdn", "Host", TypeFQDN|MustResolve, nil)
+	if err := f.ValidateValue(false, "known.example.com", ""); err != nil {
+		t.Errorf("got %v want nil\n", err)
+	}
+	err := f.ValidateValue(false, "unknown.example.com", "")
+	if err == nil || err.Error() != "Host unknown.example.com from host does not resolve" {
+		t.Errorf("got %v want resolve error\n", err)
+	}
+
+	unresolved := NewCLIFlag("host", "h", "fqdn", "Host", TypeFQDN, nil)
+	if err := unresolved.ValidateValue(false, "unknown.example.com", ""); err != nil {
+		t.Errorf("got %v want nil\n", err)
+	}
+}
+
+func TestValidateValueContext(t *testing.T) {
+	f := NewCLIFlag("input", "i", "file", "Input", TypePathFile|Required, nil)
+
+	if err := f.ValidateValueContext(context.Background(), false, "cli.go", ""); err != nil {
+		t.Errorf("got %v want nil\n", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := f.ValidateValueContext(ctx, false, "cli.go", "")
+	if err == nil || err.Error() != "Validation of input was stopped: context canceled" {
+		t.Errorf("got %v want stopped error\n", err)
+	}
+
+	defer func(fn func(context.Context, string) ([]string, error)) { lookupHost = fn }(lookupHost)
+	lookupHost = func(ctx context.Context, h string) ([]string, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	host := NewCLIFlag("host", "h", "fqdn", "Host", TypeFQDN|MustResolve, nil)
+	host.SetResolveTimeout(time.Hour)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := host.ValidateValueContext(ctx, false, "slow.example.com", ""); err == nil {
+		t.Errorf("got nil want error\n")
+	}
+}
+
+func TestJSONShape(t *testing.T) {
+	dir := t.TempDir()
+	arr := filepath.Join(dir, "arr.json")
+	os.WriteFile(arr, []byte("  [1, 2]"), 0644)
+	obj := filepath.Join(dir, "obj.json")
+	os.WriteFile(obj, []byte("{\"a\": 1}"), 0644)
+
+	fileArr := NewCLIFlag("list", "l", "file", "List", TypePathRegularFile|ValidJSON|JSONMustBeArray, nil)
+	inlineObj := NewCLIFlag("map", "m", "json", "Map", TypeString|ValidJSON|JSONMustBeObject, nil)
+	inline := NewCLIFlag("any", "a", "json", "Any JSON", TypeString|ValidJSON, nil)
+
+	for _, tc := range []struct {
+		f     *CLIFlag
+		v     string
+		valid bool
+	}{
+		{fileArr, arr, true},
+		{fileArr, obj, false},
+		{inlineObj, "{\"cpu\": 2}", true},
+		{inlineObj, "[1]", false},
+		{inlineObj, "{", false},
+		{inline, "\"text\"", true},
+		{inline, "text", false},
+		{inline, "", true},
+	} {
+		err := tc.f.ValidateValue(false, tc.v, "")
+		if tc.valid && err != nil {
+			t.Errorf("%s: got %v want nil\n", tc.v, err)
+		}
+		if !tc.valid && err == nil {
+			t.Errorf("%s: got nil want error\n", tc.v)
+		}
+	}
+}
+
+func TestVersion(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.AddCmd("start", "Start the application", h)
+
+	t.Run("exit with code 0 when version is printed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "--version"}, 0)
+	})
+
+	t.Run("version set by caller takes precedence over build info", func(t *testing.T) {
+		if c.Version() == "" {
+			t.Errorf("got empty version want build info or unknown\n")
+		}
+		c.SetVersion("1.2.3")
+		if c.Version() != "1.2.3" {
+			t.Errorf("got %s want 1.2.3\n", c.Version())
+		}
+	})
+}
+
+func TestHelpCmd(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.AddCmd("start", "Start the application", h)
+
+	t.Run("exit with code 0 when general help is printed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "help"}, 0)
+	})
+
+	t.Run("exit with code 0 when help of a command is printed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "help", "start"}, 0)
+	})
+
+	t.Run("exit with code 1 when help of invalid command is requested", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "help", "stop"}, 1)
+	})
+
+	t.Run("run command named help when it is defined", func(t *testing.T) {
+		c.AddCmd("help", "Custom help", func(c *CLI) int { return 3 })
+		assertExitCode(t, c, []string{"test", "help"}, 3)
+	})
+}
+
+func TestUsage(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("name", "n", "NAME", "Name", TypeString|Required, nil)
+	cmd.AddFlag("verbose", "v", "", "Verbose", TypeBool, nil)
+	cmd.AddArg("file", "FILE", "File", TypeString|Required)
+	os.Args = []string{"test"}
+
+	want := "Usage:  test start --name NAME [--verbose] FILE"
+	if cmd.Usage() != want {
+		t.Errorf("got %q want %q\n", cmd.Usage(), want)
+	}
+
+	os.Args = []string{"test", "start", "-n", "x", "a.txt", "100%"}
+	f, _ := os.CreateTemp(t.TempDir(), "stderr")
+	defer f.Close()
+	if code := c.Run(f, f); code != 1 {
+		t.Errorf("got %d want 1\n", code)
+	}
+	dat, _ := os.ReadFile(f.Name())
+	if !strings.Contains(string(dat), want+"\nERROR: Unexpected argument 100%\n") {
+		t.Errorf("got %q want error with value printed as it is\n", dat)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	f := NewCLIFlag("level", "", "LEVEL", "Level", TypeInt, nil)
+	err := f.ValidateValue(false, "abc", "")
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v want ValidationError\n", err)
+	}
+	if verr.Name != "level" || verr.Rule != "type" || verr.Expected != "int" || verr.Value != "abc" {
+		t.Errorf("got %+v\n", verr)
+	}
+	if err.Error() != "Flag level has invalid value" {
+		t.Errorf("got %s\n", err.Error())
+	}
+
+	f = NewCLIFlag("dir", "", "DIR", "Dir", TypePathDir, nil)
+	err = f.ValidateValue(false, "/nonexisting-dir", "")
+	if !errors.As(err, &verr) || verr.Rule != "exists" || verr.Expected != "existing directory" {
+		t.Errorf("got %+v\n", err)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	vs, d := NewCLIFlag("debug", "", "", "Debug", TypeBoolLoose, nil).Completion()
+	if len(vs) == 0 || d != "" {
+		t.Errorf("got %v %q want bool values\n", vs, d)
+	}
+	vs, d = NewCLIFlag("dir", "", "DIR", "Dir", TypePathDir, nil).Completion()
+	if vs != nil || d != "dir" {
+		t.Errorf("got %v %q want dir directive\n", vs, d)
+	}
+	vs, d = NewCLIFlag("file", "", "FILE", "File", TypePathRegularFile, nil).Completion()
+	if vs != nil || d != "file" {
+		t.Errorf("got %v %q want file directive\n", vs, d)
+	}
+}
+
+func TestCount(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("name", "n", "NAME", "Name", TypeString|AllowDuplicate, nil)
+	cmd.AddFlag("verbose", "v", "", "Verbose", TypeBool|AllowDuplicate, nil)
+	cmd.AddFlag("quiet", "", "", "Quiet", TypeBool, nil)
+
+	assertExitCode(t, c, []string{"test", "start", "--name", "a", "--name", "b", "-v", "-v", "-v"}, 0)
+	for n, want := range map[string]int{"name": 2, "verbose": 3, "quiet": 0} {
+		if cmd.Count(n) != want {
+			t.Errorf("got %d want %d for %s\n", cmd.Count(n), want, n)
+		}
+	}
+}
+
+func TestDuplicateFlag(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("name", "n", "NAME", "Name", TypeString, nil)
+	cmd.AddFlag("tag", "", "TAG", "Tag", TypeString|AllowDuplicate, nil)
+
+	t.Run("exit with code 1 when flag is passed twice", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--name", "a", "--name", "b"}, 1)
+	})
+
+	t.Run("exit with code 1 and report conflict when flag is passed with alias and name", func(t *testing.T) {
+		os.Args = []string{"test", "start", "-n", "a", "--name", "b"}
+		f, _ := os.CreateTemp(t.TempDir(), "stderr")
+		defer f.Close()
+		if code := c.Run(f, f); code != 1 {
+			t.Errorf("got %d want 1\n", code)
+		}
+		dat, _ := os.ReadFile(f.Name())
+		if !strings.Contains(string(dat), "Both -n and --name passed") {
+			t.Errorf("got %q want conflict of alias and name\n", dat)
+		}
+	})
+
+	t.Run("exit with code 0 and last value wins when flag allows duplicates", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--tag", "a", "--tag", "b"}, 0)
+		if c.Flag("tag") != "b" {
+			t.Errorf("got %s want b\n", c.Flag("tag"))
+		}
+	})
+}
+
+func TestDuration(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	f := cmd.AddFlag("timeout", "", "DURATION", "Timeout", TypeDuration, nil)
+	f.SetDurationRange(time.Second, 5*time.Minute)
+
+	for v, code := range map[string]int{"30s": 0, "5m": 0, "1s": 0, "500ms": 1, "5m1s": 1, "1h": 1, "abc": 1, "5": 1} {
+		t.Run("validate duration "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "start", "--timeout", v}, code)
+		})
+	}
+
+	err := f.ValidateValue(false, "1h", "")
+	if err == nil || err.Error() != "Flag timeout must be between 1s and 5m0s" {
+		t.Errorf("got %v\n", err)
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	f := cmd.AddFlag("max-size", "", "SIZE", "Max size", TypeByteSize, nil)
+
+	for v, want := range map[string]int64{"512": 512, "10KB": 10000, "10kb": 10000, "1.5KiB": 1536, "2MiB": 2097152, "1GB": 1000000000} {
+		t.Run("parse byte size "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "start", "--max-size", v}, 0)
+			if c.FlagByteSize("max-size") != want {
+				t.Errorf("got %d want %d\n", c.FlagByteSize("max-size"), want)
+			}
+		})
+	}
+
+	for _, v := range []string{"10XB", "-10MB", "MB", "1..5KB", "99999999TB"} {
+		t.Run("exit with code 1 for byte size "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "start", "--max-size", v}, 1)
+		})
+	}
+
+	f.SetByteSizeRange(1024, 1<<20)
+	t.Run("exit with code 1 when byte size is out of range", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--max-size", "2MiB"}, 1)
+		assertExitCode(t, c, []string{"test", "start", "--max-size", "1000"}, 1)
+		assertExitCode(t, c, []string{"test", "start", "--max-size", "1KiB"}, 0)
+	})
+}
+
+func TestRate(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("limit", "", "RATE", "Bandwidth limit", TypeRate, nil)
+
+	for v, want := range map[string]int64{"5MB/s": 5000000, "100KB/s": 100000, "1KiB/s": 1024, "300/s": 300} {
+		t.Run("parse rate "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "start", "--limit", v}, 0)
+			if c.FlagRate("limit") != want {
+				t.Errorf("got %d want %d\n", c.FlagRate("limit"), want)
+			}
+		})
+	}
+
+	for _, v := range []string{"5MB", "5XB/s", "5MB/h", "/s", "-1KB/s"} {
+		t.Run("exit with code 1 for rate "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "start", "--limit", v}, 1)
+		})
+	}
+}
+
+func TestCompanion(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("min", "", "MIN", "Minimum", TypeInt, nil).SetCompanion("max")
+	cmd.AddFlag("max", "", "MAX", "Maximum", TypeInt, nil)
+
+	t.Run("exit with code 0 when both flags are passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--min", "1", "--max", "5"}, 0)
+	})
+
+	t.Run("exit with code 0 when neither of the flags is passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start"}, 0)
+	})
+
+	t.Run("exit with code 1 when only one of the flags is passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--min", "1"}, 1)
+		assertExitCode(t, c, []string{"test", "start", "--max", "5"}, 1)
+	})
+
+	t.Run("return error when companion does not exist", func(t *testing.T) {
+		cmd.AddFlag("from", "", "FROM", "From", TypeInt, nil).SetCompanion("to")
+		assertExitCode(t, c, []string{"test", "start"}, 1)
+		if _, err := cmd.Report(c, nil); err == nil || err.Error() != "Companion to of flag from does not exist" {
+			t.Errorf("got %v want missing companion error\n", err)
+		}
+		if err := c.ParseQuery("start", "min=1&max=5"); err == nil {
+			t.Errorf("got nil want missing companion error\n")
+		}
+	})
+}
+
+func TestNoArgs(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.AddCmd("start", "Start the application", func(c *CLI) int { return 3 })
+
+	t.Run("exit with code 0 when help is printed by default", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test"}, 0)
+	})
+
+	t.Run("exit with code 2 when no arguments is an error", func(t *testing.T) {
+		c.SetNoArgs(NoArgsError, "")
+		assertExitCode(t, c, []string{"test"}, 2)
+	})
+
+	t.Run("run default command when there are no arguments", func(t *testing.T) {
+		c.SetNoArgs(NoArgsRunCmd, "start")
+		assertExitCode(t, c, []string{"test"}, 3)
+	})
+}
+
+func TestFlagBuilder(t *testing.T) {
+	f := NewFlag("config").Alias("c").HelpValue("FILE").Desc("Config file").Int().PathFile().MustExist().Required().Build()
+	if f.Flags() != TypePathFile|MustExist|Required {
+		t.Errorf("got %d want %d\n", f.Flags(), TypePathFile|MustExist|Required)
+	}
+	if f.Name() != "config" || f.Alias() != "c" || f.HelpValue() != "FILE" || f.Desc() != "Config file" {
+		t.Errorf("got %s %s %s %s\n", f.Name(), f.Alias(), f.HelpValue(), f.Desc())
+	}
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AttachFlag(NewFlag("username").Alphanumeric().AllowDots().Build())
+	t.Run("exit with code 0 when value of built flag is valid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--username", "a.b"}, 0)
+	})
+	t.Run("exit with code 1 when value of built flag is invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--username", "a_b"}, 1)
+	})
+}
+
+func TestHiddenCmd(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.AddCmd("start", "Start the application", h)
+	c.AddCmd("shortcut", "Power-user shortcut", h).SetHidden(true)
+	c.AddCmd("internal", "Internal command", h).SetHiddenFromCompletion(true)
+
+	got := strings.Join(c.CompletionCmds(), ",")
+	if got != "shortcut,start" {
+		t.Errorf("got %s want shortcut,start\n", got)
+	}
+
+	t.Run("exit with code 0 when hidden command is run", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "shortcut"}, 0)
+	})
+}
+
+func TestPrintConfig(t *testing.T) {
+	handled := false
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", func(c *CLI) int {
+		handled = true
+		return 0
+	})
+	cmd.AddFlag("name", "", "NAME", "Name", TypeString, nil)
+	cmd.AddFlag("token", "", "TOKEN", "Token", TypeString|Secret, nil)
+	cmd.AddArg("file", "FILE", "File", TypeString)
+
+	t.Run("exit with code 1 when print-config is not enabled", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--print-config"}, 1)
+	})
+
+	c.SetPrintConfig(true)
+	t.Run("print values as JSON without running the handler", func(t *testing.T) {
+		code, out := runWithOutput(t, c, []string{"test", "start", "--name", "x", "--print-config", "--token", "s3cret", "a.txt"})
+		if code != 0 || handled {
+			t.Errorf("got %d and handler run %v\n", code, handled)
+		}
+		for _, want := range []string{`"name": "x"`, `"token": "********"`, `"file": "a.txt"`} {
+			if !strings.Contains(out, want) {
+				t.Errorf("got %s want it to contain %s\n", out, want)
+			}
+		}
+	})
+
+	t.Run("exit with code 1 when values are invalid", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--print-config", "--unknown"}, 1)
+	})
+
+	t.Run("keep os.Args unchanged", func(t *testing.T) {
+		args := []string{"test", "start", "--print-config", "--name", "x", "a.txt"}
+		runWithOutput(t, c, args)
+		if strings.Join(os.Args, " ") != "test start --print-config --name x a.txt" {
+			t.Errorf("got %v want os.Args unchanged\n", os.Args)
+		}
+	})
+
+	t.Run("run handler when print-config is value of a flag", func(t *testing.T) {
+		handled = false
+		assertExitCode(t, c, []string{"test", "start", "--name", "--print-config", "a.txt"}, 0)
+		if !handled || c.Flag("name") != "--print-config" {
+			t.Errorf("got handler run %v and name %q want --print-config to be value of name\n", handled, c.Flag("name"))
+		}
+	})
+}
+
+func TestSeeAlso(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.AddCmd("sync", "Synchronise", h)
+	c.AddCmd("pull", "Pull changes", h)
+	c.AddCmd("push", "Push changes", h)
+	c.AddSeeAlso("sync", "pull", "push")
+
+	_, out := runWithOutput(t, c, []string{"test", "sync", "--help"})
+	if !strings.Contains(out, "See also: test pull, test push\n") {
+		t.Errorf("got %q want it to contain see also line\n", out)
+	}
+}
+
+func TestKeyValue(t *testing.T) {
+	var got map[string]int64
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("run", "Run a job", func(c *CLI) int {
+		got = c.FlagIntMap("limits")
+		return 0
+	})
+	cmd.AddFlag("limits", "", "LIMITS", "Resource limits", TypeKeyValue|AllowHyphen, nil).SetKeyValueType(TypeInt)
+	cmd.AddFlag("labels", "", "LABELS", "Labels", TypeKeyValue|ManySeparatorSemiColon, nil)
+
+	t.Run("exit with code 0 and return map of integers", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "run", "--limits", "cpu=2,mem-max=4", "--labels", "env=prod;team=a,b"}, 0)
+		if len(got) != 2 || got["cpu"] != 2 || got["mem-max"] != 4 {
+			t.Errorf("got %v want cpu=2 and mem-max=4\n", got)
+		}
+		if c.FlagMap("labels")["team"] != "a,b" {
+			t.Errorf("got %v want team=a,b\n", c.FlagMap("labels"))
+		}
+	})
+
+	for _, v := range []string{"cpu", "cpu=x", "cpu=", "=2", "cpu=1,cpu=2", "c.pu=2", "cpu=2,,mem=4"} {
+		t.Run("exit with code 1 for limits "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "run", "--limits", v}, 1)
+		})
+	}
+}
+
+func TestBaseDir(t *testing.T) {
+	base := t.TempDir()
+	outside := t.TempDir()
+	os.Mkdir(filepath.Join(base, "sub"), 0755)
+	os.WriteFile(filepath.Join(base, "sub", "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(outside, "b.txt"), []byte("b"), 0644)
+	os.Symlink(filepath.Join(outside, "b.txt"), filepath.Join(base, "link.txt"))
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("read", "Read a file", h)
+	cmd.AddFlag("file", "", "FILE", "File", TypePathRegularFile, nil).SetBaseDir(base)
+
+	t.Run("exit with code 0 when path is inside base directory", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "read", "--file", filepath.Join(base, "sub", "a.txt")}, 0)
+		assertExitCode(t, c, []string{"test", "read", "--file", filepath.Join(base, "sub", "..", "sub", "a.txt")}, 0)
+	})
+
+	t.Run("exit with code 1 when path escapes base directory", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "read", "--file", filepath.Join(outside, "b.txt")}, 1)
+		assertExitCode(t, c, []string{"test", "read", "--file", filepath.Join(base, "..", filepath.Base(outside), "b.txt")}, 1)
+		assertExitCode(t, c, []string{"test", "read", "--file", filepath.Join(base, "link.txt")}, 1)
+	})
+}
+
+func TestExtensions(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"cert.pem", "CERT.PEM", "cert.crt", "cert.txt"} {
+		os.WriteFile(filepath.Join(dir, n), []byte("x"), 0644)
+	}
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("load", "Load a certificate", h)
+	cmd.AddFlag("cert", "", "FILE", "Certificate", TypePathRegularFile, nil).SetExtensions(".pem", "crt")
+
+	for n, code := range map[string]int{"cert.pem": 0, "CERT.PEM": 0, "cert.crt": 0, "cert.txt": 1, "missing.txt": 1} {
+		t.Run("validate extension of "+n, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "load", "--cert", filepath.Join(dir, n)}, code)
+		})
+	}
+
+	err := cmd.GetFlag("cert").ValidateValue(false, filepath.Join(dir, "missing.txt"), "")
+	if err == nil || !strings.HasSuffix(err.Error(), "must have extension .pem or .crt") {
+		t.Errorf("got %v want extension error\n", err)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "real.png"), []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644)
+	os.WriteFile(filepath.Join(dir, "fake.png"), []byte("just text"), 0644)
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("upload", "Upload an image", h)
+	cmd.AddFlag("image", "", "FILE", "Image", TypePathRegularFile|CheckContentType, nil).SetContentType("image/png")
+	cmd.AddFlag("any", "", "FILE", "File", TypePathRegularFile, nil).SetContentType("image/png")
+
+	t.Run("exit with code 0 when content matches", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "upload", "--image", filepath.Join(dir, "real.png")}, 0)
+	})
+
+	t.Run("exit with code 1 when content does not match", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "upload", "--image", filepath.Join(dir, "fake.png")}, 1)
+	})
+
+	t.Run("exit with code 0 when content is not checked without modifier", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "upload", "--any", filepath.Join(dir, "fake.png")}, 0)
+	})
+
+	t.Run("exit with code 1 when content type is not set", func(t *testing.T) {
+		f := cmd.AddFlag("doc", "", "FILE", "Document", TypePathRegularFile|CheckContentType, nil)
+		assertExitCode(t, c, []string{"test", "upload"}, 1)
+		if _, err := cmd.Report(c, nil); err == nil {
+			t.Errorf("got nil want configuration error from Report\n")
+		}
+		if err := f.ValidateValue(false, filepath.Join(dir, "fake.png"), ""); err == nil || !strings.Contains(err.Error(), "SetContentType") {
+			t.Errorf("got %v want configuration error\n", err)
+		}
+	})
+}
+
+func TestMaxFileSize(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "small.txt"), make([]byte, 1024), 0644)
+	os.WriteFile(filepath.Join(dir, "big.txt"), make([]byte, 1025), 0644)
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("upload", "Upload a file", h)
+	cmd.AddFlag("file", "", "FILE", "File", TypePathRegularFile, nil).SetMaxFileSize(1024)
+
+	t.Run("exit with code 0 when file is not too big", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "upload", "--file", filepath.Join(dir, "small.txt")}, 0)
+	})
+
+	t.Run("exit with code 1 when file is too big", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "upload", "--file", filepath.Join(dir, "big.txt")}, 1)
+	})
+
+	err := cmd.GetFlag("file").ValidateValue(false, filepath.Join(dir, "big.txt"), "")
+	if err == nil || !strings.HasSuffix(err.Error(), "has 1025 bytes which is more than allowed 1024 bytes") {
+		t.Errorf("got %v want size error\n", err)
+	}
+}
+
+func TestDefaultFunc(t *testing.T) {
+	var got string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", func(c *CLI) int {
+		got = c.Flag("data-dir") + "|" + c.Flag("log-dir") + "|" + c.Flag("log-file")
+		return 0
+	})
+	cmd.AddFlag("log-file", "", "FILE", "Log file", TypeString, nil).SetDefaultFunc(func(c *CLI) string {
+		return c.Flag("log-dir") + "/app.log"
+	}, "log-dir")
+	cmd.AddFlag("log-dir", "", "DIR", "Log directory", TypeString, nil).SetDefaultFunc(func(c *CLI) string {
+		return c.Flag("data-dir") + "/logs"
+	}, "data-dir")
+	cmd.AddFlag("data-dir", "", "DIR", "Data directory", TypeString, nil).SetDefaultFunc(func(c *CLI) string {
+		return "/var/lib/app"
+	})
+
+	t.Run("exit with code 0 and evaluate defaults in order of dependencies", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start"}, 0)
+		if got != "/var/lib/app|/var/lib/app/logs|/var/lib/app/logs/app.log" {
+			t.Errorf("got %s\n", got)
+		}
+	})
+
+	t.Run("exit with code 0 and derive defaults from passed flag", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--data-dir", "/data", "--log-file", "x.log"}, 0)
+		if got != "/data|/data/logs|x.log" {
+			t.Errorf("got %s\n", got)
+		}
+	})
+
+	t.Run("return error when defaults depend on each other or on missing flag", func(t *testing.T) {
+		c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+		cmd := c.AddCmd("start", "Start the application", h)
+		cmd.AddFlag("a", "", "A", "A", TypeString, nil).SetDefaultFunc(func(c *CLI) string { return c.Flag("b") }, "b")
+		b := cmd.AddFlag("b", "", "B", "B", TypeString, nil)
+		b.SetDefaultFunc(func(c *CLI) string { return c.Flag("a") }, "a")
+		assertExitCode(t, c, []string{"test", "start"}, 1)
+		if _, err := cmd.Report(c, nil); err == nil || err.Error() != "Default values of flags a -> b -> a depend on each other" {
+			t.Errorf("got %v want cycle error\n", err)
+		}
+		b.SetDefaultFunc(func(c *CLI) string { return c.Flag("c") }, "c")
+		if err := c.ParseQuery("start", ""); err == nil || err.Error() != "Flag c that default of flag b depends on does not exist" {
+			t.Errorf("got %v want missing flag error\n", err)
+		}
+	})
+}
+
+func TestReport(t *testing.T) {
+	os.Setenv("TEST_REPORT_LEVEL", "7")
+	defer os.Unsetenv("TEST_REPORT_LEVEL")
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("name", "", "NAME", "Name", TypeAlphanumeric, nil)
+	cmd.AddFlag("level", "", "LEVEL", "Level", TypeInt, nil).SetEnv("TEST_REPORT_LEVEL")
+	cmd.AddFlag("dir", "", "DIR", "Directory", TypeString, nil).SetDefaultFunc(func(c *CLI) string {
+		return "/tmp/" + c.Flag("name")
+	}, "name")
+	cmd.AddFlag("token", "", "TOKEN", "Token", TypeInt|Secret, nil)
+	cmd.AddFlag("verbose", "", "", "Verbose", TypeBool, nil)
+
+	rs, err := cmd.Report(c, []string{"--name", "app", "--token", "s3cret", "--verbose"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]FlagReport)
+	for _, r := range rs {
+		got[r.Name] = r
+	}
+	if got["name"].Value != "app" || got["name"].Source != "flag" || got["name"].Err != nil {
+		t.Errorf("got %+v for name\n", got["name"])
+	}
+	if got["level"].Value != "7" || got["level"].Source != "env" {
+		t.Errorf("got %+v for level\n", got["level"])
+	}
+	if got["dir"].Value != "/tmp/app" || got["dir"].Source != "default" {
+		t.Errorf("got %+v for dir\n", got["dir"])
+	}
+	if got["token"].Err == nil || got["token"].Err.Rule != "type" || got["token"].Err.Value != "********" {
+		t.Errorf("got %+v for token\n", got["token"])
+	}
+	if got["verbose"].Value != "true" {
+		t.Errorf("got %+v for verbose\n", got["verbose"])
+	}
+
+	if _, err := cmd.Report(c, []string{"--unknown"}); err == nil {
+		t.Errorf("got nil want error for undefined flag\n")
+	}
+
+	cmd.AddFlag("password", "", "PASSWORD", "Password", TypeString|Secret, nil)
+	cmd.AddFlag("logs", "", "DIR", "Logs", TypeString, nil).SetDefaultFunc(func(c *CLI) string {
+		return c.Flag("password") + "/logs"
+	}, "password")
+	cmd.sources = map[string]string{"name": "env"}
+	rs, err = cmd.Report(c, []string{"--password", "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rs {
+		if r.Name == "logs" && r.Value != "********" {
+			t.Errorf("got %+v for logs want default derived from secret to be redacted\n", r)
+		}
+	}
+	if cmd.Source("name") != "env" {
+		t.Errorf("got %q want sources of the last parsing to be kept\n", cmd.Source("name"))
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "app.json"), []byte(`{"region":"eu"}`), 0644)
+	c = NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.SetTrimSpace(true)
+	c.SetConfigPaths(filepath.Join(dir, "app.json"))
+	cmd = c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("name", "", "NAME", "Name", TypeAlphanumeric, nil)
+	cmd.AddFlag("region", "", "REGION", "Region", TypeAlphanumeric, nil)
+	cmd.AddFlag("title", "", "TITLE", "Title", TypeNonEmpty, nil)
+	cmd.AddFlag("turbo", "", "", "Turbo mode", TypeBool|Experimental, nil)
+
+	rs, err = cmd.Report(c, []string{"--name", " app ", "--title", " ", "--turbo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = make(map[string]FlagReport)
+	for _, r := range rs {
+		got[r.Name] = r
+	}
+	if got["name"].Value != "app" || got["name"].Err != nil {
+		t.Errorf("got %+v for name want trimmed value\n", got["name"])
+	}
+	if got["region"].Value != "eu" || got["region"].Source != "config" {
+		t.Errorf("got %+v for region want value from config\n", got["region"])
+	}
+	if got["title"].Err == nil {
+		t.Errorf("got %+v for title want blank value error\n", got["title"])
+	}
+	if got["turbo"].Err == nil {
+		t.Errorf("got %+v for turbo want experimental error\n", got["turbo"])
+	}
+}
+
+func TestInteractivePrompt(t *testing.T) {
+	defer func(f func(*os.File) bool) { isTerminal = f }(isTerminal)
+	isTerminal = func(*os.File) bool { return true }
+
+	var got string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", func(c *CLI) int {
+		got = c.Flag("name")
+		return 0
+	})
+	cmd.AddFlag("name", "", "NAME", "Name", TypeAlphanumeric|Required, nil)
+
+	stdin := filepath.Join(t.TempDir(), "stdin")
+	setStdin := func(s string) {
+		os.WriteFile(stdin, []byte(s), 0644)
+		f, _ := os.Open(stdin)
+		t.Cleanup(func() { f.Close() })
+		c.SetStdin(f)
+	}
+
+	t.Run("exit with code 1 when prompt is not enabled", func(t *testing.T) {
+		setStdin("app\n")
+		assertExitCode(t, c, []string{"test", "start"}, 1)
+	})
+
+	c.SetInteractivePrompt(true)
+	t.Run("exit with code 0 and ask again until value is valid", func(t *testing.T) {
+		setStdin("not valid!\napp\n")
+		assertExitCode(t, c, []string{"test", "start"}, 0)
+		if got != "app" || cmd.Source("name") != "prompt" {
+			t.Errorf("got %s from %s want app from prompt\n", got, cmd.Source("name"))
+		}
+	})
+
+	t.Run("exit with code 0 when line ends with CRLF", func(t *testing.T) {
+		setStdin("app\r\n")
+		assertExitCode(t, c, []string{"test", "start"}, 0)
+		if got != "app" {
+			t.Errorf("got %q want app\n", got)
+		}
+	})
+
+	t.Run("exit with code 0 when whitespace around value is trimmed", func(t *testing.T) {
+		c.SetTrimSpace(true)
+		defer c.SetTrimSpace(false)
+		setStdin(" app \r\n")
+		assertExitCode(t, c, []string{"test", "start"}, 0)
+		if got != "app" {
+			t.Errorf("got %q want app\n", got)
+		}
+	})
+
+	t.Run("exit with code 1 when there is no more input", func(t *testing.T) {
+		setStdin("not valid!\n")
+		assertExitCode(t, c, []string{"test", "start"}, 1)
+	})
+
+	t.Run("exit with code 1 when stdin is not a terminal", func(t *testing.T) {
+		isTerminal = func(*os.File) bool { return false }
+		setStdin("app\n")
+		assertExitCode(t, c, []string{"test", "start"}, 1)
+	})
+}
+
+func TestSecretPrompt(t *testing.T) {
+	defer func(f func(*os.File) bool) { isTerminal = f }(isTerminal)
+	defer func(f func(*os.File, bool) error) { setEcho = f }(setEcho)
+	isTerminal = func(*os.File) bool { return true }
+	var echo []bool
+	setEcho = func(f *os.File, on bool) error {
+		echo = append(echo, on)
+		return nil
+	}
+
+	var got string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("login", "Log in", func(c *CLI) int {
+		got = c.Flag("password")
+		return 0
+	})
+	cmd.AddFlag("password", "", "PASSWORD", "Password", TypeString|Required|Secret, nil)
+	c.SetInteractivePrompt(true)
+
+	stdin := filepath.Join(t.TempDir(), "stdin")
+	os.WriteFile(stdin, []byte("s3cret\n"), 0644)
+	f, _ := os.Open(stdin)
+	defer f.Close()
+	c.SetStdin(f)
+
+	t.Run("exit with code 0 and read secret without echo", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "login"}, 0)
+		if got != "s3cret" || len(echo) != 2 || echo[0] || !echo[1] {
+			t.Errorf("got %s with echo %v want s3cret with echo turned off and on\n", got, echo)
+		}
+	})
+
+	t.Run("exit with code 1 when echo cannot be turned off", func(t *testing.T) {
+		setEcho = func(*os.File, bool) error { return errors.New("not a terminal") }
+		f.Seek(0, 0)
+		c.SetStdin(f)
+		assertExitCode(t, c, []string{"test", "login"}, 1)
+	})
+}
+
+func TestAnyOfTypes(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("get", "Get a user", h)
+	cmd.AddFlag("user", "", "ID", "User ID or email", TypeInt|TypeEmail|AnyOfTypes|Required, nil)
+
+	for v, code := range map[string]int{"123": 0, "a@example.com": 0, "abc": 1, "1.5": 1} {
+		t.Run("validate union value "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "get", "--user", v}, code)
+		})
+	}
+
+	t.Run("exit with code 1 when required union flag is missing", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "get"}, 1)
+	})
+
+	err := cmd.GetFlag("user").ValidateValue(false, "abc", "")
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Expected != "int or email" {
+		t.Errorf("got %v want error expecting int or email\n", err)
+	}
+}
+
+func TestPager(t *testing.T) {
+	defer func(f func(*os.File) bool) { isTerminal = f }(isTerminal)
+	isTerminal = func(*os.File) bool { return true }
+	defer os.Setenv("PAGER", os.Getenv("PAGER"))
+
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.AddCmd("start", "Start the application", h)
+	c.SetPager(true)
+
+	t.Run("print help through pager", func(t *testing.T) {
+		os.Setenv("PAGER", "sed s/Commands/Paged/")
+		code, out := runWithOutput(t, c, []string{"test", "--help"})
+		if code != 0 || !strings.Contains(out, "Paged:") {
+			t.Errorf("got %d and %q want help printed through pager\n", code, out)
+		}
+	})
+
+	t.Run("print help normally when pager cannot be started", func(t *testing.T) {
+		os.Setenv("PAGER", "/nonexisting-pager")
+		code, out := runWithOutput(t, c, []string{"test", "start", "--help"})
+		if code != 0 || !strings.Contains(out, "Start the application") {
+			t.Errorf("got %d and %q want help printed\n", code, out)
+		}
+	})
+}
+
+func TestParseQuery(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("name", "", "NAME", "Name", TypeAlphanumeric|Required, nil)
+	cmd.AddFlag("count", "", "COUNT", "Count", TypeInt, nil)
+	cmd.AddFlag("verbose", "", "", "Verbose", TypeBool, nil)
+	cmd.AddArg("file", "FILE", "File", TypeString)
+
+	if err := c.ParseQuery("start", "name=foo&count=3&verbose&file=a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Flag("name") != "foo" || c.FlagInt("count") != 3 || c.Flag("verbose") != "true" || c.Arg("file") != "a.txt" {
+		t.Errorf("got %s %d %s %s\n", c.Flag("name"), c.FlagInt("count"), c.Flag("verbose"), c.Arg("file"))
+	}
+
+	for _, q := range []string{"count=3", "name=foo&count=x", "name=foo&name=bar", "name=foo&other=1", "name=foo&verbose=maybe", "name=%zz"} {
+		if err := c.ParseQuery("start", q); err == nil {
+			t.Errorf("got nil want error for %s\n", q)
+		}
+	}
+	if err := c.ParseQuery("stop", "name=foo"); err == nil {
+		t.Errorf("got nil want error for invalid command\n")
+	}
+
+	t.Setenv("TEST_QUERY_COUNT", "5")
+	cmd.GetFlag("count").SetEnv("TEST_QUERY_COUNT")
+	cmd.AddFlag("turbo", "", "", "Turbo mode", TypeBool|Experimental, nil)
+	c.SetTrimSpace(true)
+	if err := c.ParseQuery("start", "name=+foo+"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Flag("name") != "foo" || c.FlagInt("count") != 5 || cmd.Source("count") != "env" {
+		t.Errorf("got %s %d %s want trimmed name and count from env\n", c.Flag("name"), c.FlagInt("count"), cmd.Source("count"))
+	}
+	if err := c.ParseQuery("start", "name=foo&turbo"); err == nil {
+		t.Errorf("got nil want error for experimental flag\n")
+	}
+
+	cmd.AddFlag("level", "l", "LEVEL", "Level", TypeInt, nil)
+	if err := c.ParseQuery("start", "name=foo&l=3"); err != nil || c.FlagInt("level") != 3 {
+		t.Errorf("got %v and %d want level passed with alias\n", err, c.FlagInt("level"))
+	}
+	for _, q := range []string{"name=foo&l=3&level=4", "name=foo&=1"} {
+		if err := c.ParseQuery("start", q); err == nil {
+			t.Errorf("got nil want error for %s\n", q)
+		}
+	}
+}
+
+func TestExperimental(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("turbo", "", "", "Turbo mode", TypeBool|Experimental, nil)
+	c.SetExperimentalEnv("TEST_EXPERIMENTAL")
+
+	t.Run("exit with code 1 when experimental flag is not enabled", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start", "--turbo"}, 1)
+	})
+
+	t.Run("exit with code 0 when experimental flag is not passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "start"}, 0)
+	})
+
+	t.Run("exit with code 0 when experimental flags are enabled with flag", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "--experimental", "start", "--turbo"}, 0)
+	})
+
+	t.Run("exit with code 0 when experimental flags are enabled with env", func(t *testing.T) {
+		os.Setenv("TEST_EXPERIMENTAL", "1")
+		defer os.Unsetenv("TEST_EXPERIMENTAL")
+		assertExitCode(t, c, []string{"test", "start", "--turbo"}, 0)
+	})
+
+	t.Run("hide experimental flag from help", func(t *testing.T) {
+		_, out := runWithOutput(t, c, []string{"test", "start", "--help"})
+		if strings.Contains(out, "turbo") {
+			t.Errorf("got %q want no experimental flag\n", out)
+		}
+		_, out = runWithOutput(t, c, []string{"test", "--experimental", "start", "--help"})
+		if !strings.Contains(out, "turbo") {
+			t.Errorf("got %q want experimental flag\n", out)
+		}
+	})
+}
+
+func TestParseHook(t *testing.T) {
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("level", "", "LEVEL", "Level", TypeInt, nil)
+	cmd.AddFlag("token", "", "TOKEN", "Token", TypeString|Secret, nil)
+	c.SetParseHook(func(e ParseEvent) {
+		got = append(got, fmt.Sprintf("%d:%s:%s:%s", e.Kind, e.Cmd, e.Flag, e.Value))
+	})
+
+	t.Run("send events of successful parsing", func(t *testing.T) {
+		got = nil
+		assertExitCode(t, c, []string{"test", "start", "--level", "3", "--token", "s3cret"}, 0)
+		want := "0:start:level:3 1:start:level:3 0:start:token:******** 1:start:token:******** 3:start::"
+		if strings.Join(got, " ") != want {
+			t.Errorf("got %q want %q\n", strings.Join(got, " "), want)
+		}
+	})
+
+	t.Run("send event of failed validation", func(t *testing.T) {
+		got = nil
+		assertExitCode(t, c, []string{"test", "start", "--level", "x"}, 1)
+		want := "0:start:level:x 2:start:level:"
+		if strings.Join(got, " ") != want {
+			t.Errorf("got %q want %q\n", strings.Join(got, " "), want)
+		}
+	})
+}
+
+func TestRatio(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("sample", "Sample events", h)
+	cmd.AddFlag("sample-rate", "", "RATIO", "Sample rate", TypeRatio, nil)
+
+	for v, code := range map[string]int{"0.25": 0, "0": 0, "1": 0, "1.0": 0, "1.5": 1, "-0.1": 1, "NaN": 1, "Inf": 1, "+Inf": 1, "0x1p-2": 1, "1e-1": 1, ".5": 1, "abc": 1} {
+		t.Run("validate ratio "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "sample", "--sample-rate", v}, code)
+		})
+	}
+}
+
+func TestExactlyOneFlags(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("login", "Log in", h)
+	cmd.AddFlag("password", "", "PASSWORD", "Password", TypeString, nil)
+	cmd.AddFlag("token", "", "TOKEN", "Token", TypeString, nil)
+	cmd.AddFlag("sso", "", "", "Single sign-on", TypeBool, nil)
+	cmd.AddExactlyOneFlags("password", "token", "sso")
+
+	t.Run("exit with code 0 when exactly one flag is passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "login", "--token", "x"}, 0)
+		assertExitCode(t, c, []string{"test", "login", "--sso"}, 0)
+	})
+
+	t.Run("exit with code 1 when no flag is passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "login"}, 1)
+	})
+
+	t.Run("exit with code 1 when more than one flag is passed", func(t *testing.T) {
+		assertExitCode(t, c, []string{"test", "login", "--token", "x", "--sso"}, 1)
+	})
+
+	err := cmd.validateRelations(map[string]string{"password": "a", "token": "b", "sso": "false"})
+	if err == nil || err.Error() != "Exactly one of flags --password, --token, --sso is required but --password, --token were passed" {
+		t.Errorf("got %v\n", err)
+	}
+}
+
+func TestPatternCache(t *testing.T) {
+	a := NewCLIFlag("a", "", "INT", "A", TypeInt|AllowMany, nil)
+	b := NewCLIFlag("b", "", "INT", "B", TypeInt|AllowMany, nil)
+	o := NewCLIFlag("o", "", "INT", "O", TypeInt, nil)
+	if a.compiledPattern() != b.compiledPattern() {
+		t.Errorf("got different patterns want the same one for the same configuration\n")
+	}
+	if a.compiledPattern() == o.compiledPattern() {
+		t.Errorf("got the same pattern want different ones for different configurations\n")
+	}
+}
+
+func TestValidateValueConcurrently(t *testing.T) {
+	flags := []*CLIFlag{
+		NewCLIFlag("int", "", "INT", "Int", TypeInt|AllowMany, nil),
+		NewCLIFlag("float", "", "FLOAT", "Float", TypeFloat, nil),
+		NewCLIFlag("name", "", "NAME", "Name", TypeAlphanumeric|AllowHyphen|AllowDots, nil),
+		NewCLIFlag("user", "", "USER", "User", TypeInt|TypeEmail|AnyOfTypes, nil),
+	}
+	flags[2].SetPattern("[a-z.-]+")
+	values := []string{"1,2,3", "1.5", "my-name.x", "a@example.com"}
+
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func() {
+			for j := 0; j < 100; j++ {
+				for k, f := range flags {
+					if err := f.ValidateValue(false, values[k], ""); err != nil {
+						done <- err
+						return
+					}
+				}
+			}
+			done <- nil
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("got %v want nil\n", err)
+		}
+	}
+}
+
+func TestSchema(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.SetVersion("1.0.0")
+	cmd := c.AddCmd("start", "Start the application", h)
+	cmd.AddFlag("name", "n", "NAME", "Name", TypeAlphanumeric|Required, nil)
+	cmd.AddFlag("min", "", "MIN", "Minimum", TypeInt, nil).SetCompanion("max")
+	cmd.AddFlag("max", "", "MAX", "Maximum", TypeInt, nil)
+	cmd.AddArg("file", "FILE", "File", TypeString|Required)
+	cmd.AddVariadicArg("rest", "REST", "Rest", TypeString, 0, 3)
+
+	dat, err := c.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Version  string `json:"version"`
+		Commands []struct {
+			Name  string `json:"name"`
+			Flags []struct {
+				Name     string   `json:"name"`
+				Type     string   `json:"type"`
+				Required bool     `json:"required"`
+				Requires []string `json:"requires"`
+			} `json:"flags"`
+			Args     []struct{ Name string } `json:"args"`
+			Variadic struct{ Max int }       `json:"variadic"`
+		} `json:"commands"`
+	}
+	if err := json.Unmarshal(dat, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "1.0.0" || len(got.Commands) != 1 || len(got.Commands[0].Flags) != 3 {
+		t.Fatalf("got %s\n", dat)
+	}
+	fs := got.Commands[0].Flags
+	if fs[0].Name != "max" || strings.Join(fs[0].Requires, ",") != "min" || fs[2].Name != "name" || fs[2].Type != "alphanumeric" || !fs[2].Required {
+		t.Errorf("got %s\n", dat)
+	}
+	if got.Commands[0].Args[0].Name != "file" || got.Commands[0].Variadic.Max != 3 {
+		t.Errorf("got %s\n", dat)
+	}
+
+	again, _ := c.Schema()
+	if string(again) != string(dat) {
+		t.Errorf("got different schemas of the same CLI\n")
+	}
+}
+
+func TestFlagJSON(t *testing.T) {
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "config.json")
+	os.WriteFile(cfg, []byte(`{"name":"app","replicas":3}`), 0644)
+
+	var got struct {
+		Name     string `json:"name"`
+		Replicas int    `json:"replicas"`
+	}
+	var inline map[string]interface{}
+	var errs []error
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("deploy", "Deploy", func(c *CLI) int {
+		// file is changed after validation and the handler gets what was validated
+		os.WriteFile(cfg, []byte(`{"name":"changed"}`), 0644)
+		errs = []error{c.FlagJSON("config", &got), c.FlagJSON("labels", &inline), c.FlagJSON("name", &inline)}
+		return 0
+	})
+	cmd.AddFlag("config", "", "FILE", "Config", TypePathRegularFile|ValidJSON, nil)
+	cmd.AddFlag("labels", "", "JSON", "Labels", TypeString|ValidJSON, nil)
+	cmd.AddFlag("name", "", "NAME", "Name", TypeString, nil)
+
+	assertExitCode(t, c, []string{"test", "deploy", "--config", cfg, "--labels", `{"env":"prod"}`}, 0)
+	if errs[0] != nil || got.Name != "app" || got.Replicas != 3 {
+		t.Errorf("got %v %+v want parsed config\n", errs[0], got)
+	}
+	if errs[1] != nil || inline["env"] != "prod" {
+		t.Errorf("got %v %v want parsed labels\n", errs[1], inline)
+	}
+	if errs[2] == nil {
+		t.Errorf("got nil want error for flag that is not JSON\n")
+	}
+}
+
+func TestTrimSpace(t *testing.T) {
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("scale", "Scale", func(c *CLI) int {
+		got = []string{c.Flag("replicas"), c.Flag("label"), c.Arg("name")}
+		return 0
+	})
+	cmd.AddFlag("replicas", "", "INT", "Replicas", TypeInt, nil)
+	cmd.AddFlag("label", "", "LABEL", "Label", TypeString|NoTrimSpace, nil)
+	cmd.AddArg("name", "NAME", "", TypeAlphanumeric|Required)
+
+	assertExitCode(t, c, []string{"test", "scale", "--replicas", " 5 ", " app "}, 1)
+
+	c.SetTrimSpace(true)
+	assertExitCode(t, c, []string{"test", "scale", "--replicas", " 5 ", "--label", " x ", " app\t"}, 0)
+	if got[0] != "5" || got[1] != " x " || got[2] != "app" {
+		t.Errorf("got %q want trimmed values except the one with NoTrimSpace\n", got)
+	}
+
+	c.SetTrimSpace(false)
+	cmd.GetFlag("replicas").nflags |= TrimSpace
+	assertExitCode(t, c, []string{"test", "scale", "--replicas", " 5 ", "app"}, 0)
+	if got[0] != "5" {
+		t.Errorf("got %q want value of TrimSpace flag trimmed\n", got[0])
+	}
+}
+
+func TestFlagConflict(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("scale", "Scale", h)
+	cmd.AddFlag("replicas", "r", "INT", "Replicas", TypeInt, nil)
+
+	for _, f := range []*CLIFlag{
+		NewCLIFlag("replicas", "", "INT", "Replicas", TypeInt, nil),
+		NewCLIFlag("region", "r", "REGION", "Region", TypeString, nil),
+		NewCLIFlag("r", "", "REGION", "Region", TypeString, nil),
+		NewCLIFlag("rate", "replicas", "RATE", "Rate", TypeString, nil),
+		NewCLIFlag("help", "", "", "Help", TypeBool, nil),
+		NewCLIFlag("host", "h", "HOST", "Host", TypeString, nil),
+	} {
+		if cmd.flagConflict(f) == nil {
+			t.Errorf("got nil want error for flag %s -%s\n", f.name, f.alias)
+		}
+	}
+	if err := cmd.flagConflict(NewCLIFlag("region", "g", "REGION", "Region", TypeString, nil)); err != nil {
+		t.Errorf("got %v want nil for flag that does not conflict\n", err)
+	}
+
+	if err := cmd.flagConflict(NewCLIFlag("print-config", "", "", "Print config", TypeBool, nil)); err != nil {
+		t.Errorf("got %v want nil for print-config when it is not enabled\n", err)
+	}
+	c.SetPrintConfig(true)
+	if cmd.flagConflict(NewCLIFlag("print-config", "", "", "Print config", TypeBool, nil)) == nil {
+		t.Errorf("got nil want error for print-config when it is enabled\n")
+	}
+	if c.AddCmd("status", "Status", h).flagConflict(NewCLIFlag("print-config", "", "", "Print config", TypeBool, nil)) == nil {
+		t.Errorf("got nil want error for print-config of command added after it is enabled\n")
+	}
+	c.SetPrintConfig(false)
+
+	c.AddFlagToCmds("verbose", "v", "", "Verbose", TypeBool, nil)
+	if cmd.GetFlag("verbose") == nil {
+		t.Errorf("got nil want flag added to commands\n")
+	}
+}
+
+func TestURLPath(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("route", "Add route", h)
+	cmd.AddFlag("path", "", "PATH", "Path", TypeURLPath, nil)
+
+	for v, code := range map[string]int{
+		"/api/v1/users": 0, "/": 0, "/users/%7Bid%7D": 0, "/a:b@c/~d": 0,
+		"api/v1": 1, "https://example.com/api": 1, "//example.com/api": 1, "/api?x=1": 1, "/api#top": 1, "/a b": 1, "/%zz": 1,
+	} {
+		t.Run("validate url path "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "route", "--path", v}, code)
+		})
+	}
+}
+
+func TestDotEnv(t *testing.T) {
+	dir := t.TempDir()
+	env := filepath.Join(dir, ".env")
+	os.WriteFile(env, []byte("# database\nDB_HOST=localhost\n\nexport DB_PORT=5432\nDB_NAME=\"app db\"\nEMPTY=\n"), 0644)
+	invalid := filepath.Join(dir, "invalid.env")
+	os.WriteFile(invalid, []byte("DB_HOST=localhost\nnot an assignment\n"), 0644)
+	badKey := filepath.Join(dir, "key.env")
+	os.WriteFile(badKey, []byte("1DB=x\n"), 0644)
+
+	var got map[string]string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("run", "Run", func(c *CLI) int {
+		got = c.FlagDotEnv("env-file")
+		return 0
+	})
+	cmd.AddFlag("env-file", "", "FILE", "Env file", TypePathRegularFile|DotEnv, nil)
+
+	assertExitCode(t, c, []string{"test", "run", "--env-file", env}, 0)
+	want := map[string]string{"DB_HOST": "localhost", "DB_PORT": "5432", "DB_NAME": "app db", "EMPTY": ""}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v want %v\n", got, want)
+	}
+	assertExitCode(t, c, []string{"test", "run", "--env-file", invalid}, 1)
+	assertExitCode(t, c, []string{"test", "run", "--env-file", badKey}, 1)
+
+	err := cmd.GetFlag("env-file").ValidateValue(false, invalid, "")
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Rule != "dotenv" || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("got %v want dotenv error on line 2\n", err)
+	}
+}
+
+func TestJWT(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("call", "Call API", h)
+	cmd.AddFlag("token", "", "TOKEN", "Token", TypeJWT, nil)
+
+	// {"alg":"HS256","typ":"JWT"} and {"sub":"1234567890","name":"John Doe"}
+	header, payload := "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9", "eyJzdWIiOiIxMjM0NTY3ODkwIiwibmFtZSI6IkpvaG4gRG9lIn0"
+	for v, code := range map[string]int{
+		header + "." + payload + ".SflKxwRJSMeKKF2QT4fwpMeJf36POk6yJV_adQssw5c": 0,
+		header + "." + payload + ".":          0,
+		header + "." + payload:                1,
+		header + "." + payload + ".sig.extra": 1,
+		header + "." + payload + "=.sig":      1,
+		"bm90IGpzb24." + payload + ".sig":     1,
+		"WzFd." + payload + ".sig":            1,
+		"a.b.c":                               1,
+	} {
+		t.Run("validate jwt "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "call", "--token", v}, code)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	trace := func(n string) Middleware {
+		return func(next Handler) Handler {
+			return func(c *CLI) int {
+				calls = append(calls, n+" before")
+				code := next(c)
+				calls = append(calls, n+" after")
+				return code
+			}
+		}
+	}
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	c.AddCmd("build", "Build", func(c *CLI) int {
+		calls = append(calls, "handler")
+		return 3
+	})
+	c.AddCmd("crash", "Crash", func(c *CLI) int {
+		panic("boom")
+	})
+	c.Use(trace("outer"), trace("inner"))
+	c.Use(Recover)
+
+	assertExitCode(t, c, []string{"test", "build"}, 3)
+	want := []string{"outer before", "inner before", "handler", "inner after", "outer after"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v want %v\n", calls, want)
+	}
+
+	os.Args = []string{"test", "crash"}
+	f, _ := os.CreateTemp(t.TempDir(), "stderr")
+	defer f.Close()
+	if code := c.Run(f, f); code != 1 {
+		t.Errorf("got %d want 1\n", code)
+	}
+	dat, _ := os.ReadFile(f.Name())
+	if !strings.Contains(string(dat), "ERROR: Command crash panicked: boom") || !strings.Contains(string(dat), "goroutine") {
+		t.Errorf("got %q want panic with stack trace\n", dat)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("crash", "Crash", func(c *CLI) int {
+		panic("handler boom")
+	})
+	cmd.AddFlag("debug", "", "", "Debug", TypeBool, func(cmd *CLICmd) {
+		panic("callback boom")
+	})
+	c.SetRecoverPanics(true)
+
+	for name, args := range map[string][]string{"handler boom": {"test", "crash"}, "callback boom": {"test", "crash", "--debug"}} {
+		t.Run("recover from "+name, func(t *testing.T) {
+			os.Args = args
+			f, _ := os.CreateTemp(t.TempDir(), "stderr")
+			defer f.Close()
+			if code := c.Run(f, f); code != 1 {
+				t.Errorf("got %d want 1\n", code)
+			}
+			dat, _ := os.ReadFile(f.Name())
+			if !strings.Contains(string(dat), "panicked: "+name) || !strings.Contains(string(dat), "goroutine") {
+				t.Errorf("got %q want panic with stack trace\n", dat)
+			}
+		})
+	}
+
+	c.SetRecoverPanics(false)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("got no panic want panic when recovery is not set\n")
+		}
+	}()
+	assertExitCode(t, c, []string{"test", "crash"}, 1)
+}
+
+func TestExpandGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []string{"a.log", "b.log", "c.txt"} {
+		os.WriteFile(filepath.Join(dir, n), []byte("x"), 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "d.log"), 0755)
+
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("upload", "Upload", func(c *CLI) int {
+		got = c.FlagGlob("files")
+		return 0
+	})
+	cmd.AddFlag("files", "", "GLOB", "Files", TypePathRegularFile|ExpandGlob, nil)
+	strict := c.AddCmd("strict", "Upload", h)
+	strict.AddFlag("files", "", "GLOB", "Files", TypePathRegularFile|ExpandGlob|GlobMustMatch, nil)
+
+	assertExitCode(t, c, []string{"test", "upload", "--files", filepath.Join(dir, "*.txt")}, 0)
+	if len(got) != 1 || got[0] != filepath.Join(dir, "c.txt") {
+		t.Errorf("got %v want c.txt\n", got)
+	}
+	assertExitCode(t, c, []string{"test", "upload", "--files", filepath.Join(dir, "[ab].log")}, 0)
+	if len(got) != 2 {
+		t.Errorf("got %v want a.log and b.log\n", got)
+	}
+	// directory d.log is not a regular file
+	assertExitCode(t, c, []string{"test", "upload", "--files", filepath.Join(dir, "*.log")}, 1)
+	assertExitCode(t, c, []string{"test", "upload", "--files", filepath.Join(dir, "[")}, 1)
+	assertExitCode(t, c, []string{"test", "upload", "--files", filepath.Join(dir, "*.csv")}, 0)
+	assertExitCode(t, c, []string{"test", "strict", "--files", filepath.Join(dir, "*.csv")}, 1)
+
+	t.Setenv("HOME", dir)
+	home := c.AddCmd("home", "Upload", func(c *CLI) int {
+		// file created after validation is not returned
+		os.WriteFile(filepath.Join(dir, "e.txt"), []byte("x"), 0644)
+		got = c.FlagGlob("files")
+		return 0
+	})
+	home.AddFlag("files", "", "GLOB", "Files", TypePathRegularFile|ExpandGlob|ExpandHome|GlobMustMatch, nil)
+	assertExitCode(t, c, []string{"test", "home", "--files", "~/*.txt"}, 0)
+	if len(got) != 1 || got[0] != filepath.Join(dir, "c.txt") {
+		t.Errorf("got %v want validated c.txt\n", got)
+	}
+}
+
+func TestHelpSkipsValidation(t *testing.T) {
+	ran := false
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("deploy", "Deploy", func(c *CLI) int {
+		ran = true
+		return 0
+	})
+	cmd.AddFlag("env", "", "ENV", "Environment", TypeAlphanumeric|Required, nil)
+	cmd.AddFlag("message", "m", "MSG", "Message", TypeString, nil)
+	cmd.AddArg("target", "TARGET", "", TypeAlphanumeric|Required)
+
+	for _, args := range [][]string{
+		{"test", "deploy", "--help"},
+		{"test", "deploy", "--env", "invalid!", "-h"},
+		{"test", "deploy", "-m", "x", "--help", "target"},
+	} {
+		code, out := runWithOutput(t, c, args)
+		if code != 0 || !strings.Contains(out, "Usage:") || ran {
+			t.Errorf("got %d %q want help for %v\n", code, out, args)
+		}
+	}
+
+	// --help is a value of the flag or comes after --
+	assertExitCode(t, c, []string{"test", "deploy", "--env", "prod", "-m", "--help", "app"}, 0)
+	if !ran {
+		t.Errorf("got help want command run when --help is a value of a flag\n")
+	}
+	assertExitCode(t, c, []string{"test", "deploy", "--", "--help"}, 1)
+}
+
+func TestConfigPaths(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "app.json"), []byte(`{"region":"eu","replicas":3,"ratio":2.0,"verbose":true,"zones":["a","b"],"other":1}`), 0644)
+	os.WriteFile(filepath.Join(dir, "invalid.json"), []byte(`{"replicas":[1]}`), 0644)
+	t.Setenv("TEST_CONFIG_DIR", dir)
+	t.Setenv("TEST_REGION", "")
+
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("scale", "Scale", func(c *CLI) int {
+		got = []string{c.Flag("region"), c.Flag("replicas"), c.Flag("verbose"), c.Flag("zones"), c.cmd.Source("region"), c.Flag("ratio")}
+		return 0
+	})
+	cmd.AddFlag("region", "", "REGION", "Region", TypeAlphanumeric, nil).SetEnv("TEST_REGION")
+	cmd.AddFlag("replicas", "", "INT", "Replicas", TypeInt, nil)
+	cmd.AddFlag("ratio", "", "FLOAT", "Ratio", TypeFloat, nil)
+	cmd.AddFlag("verbose", "", "", "Verbose", TypeBool, nil)
+	cmd.AddFlag("zones", "", "ZONES", "Zones", TypeAlphanumeric|AllowMany, nil)
+	c.SetConfigPaths(filepath.Join(dir, "missing.json"), "$TEST_CONFIG_DIR/app.json", filepath.Join(dir, "invalid.json"))
+
+	assertExitCode(t, c, []string{"test", "scale"}, 0)
+	if strings.Join(got, " ") != "eu 3 true a,b config 2.0" {
+		t.Errorf("got %q want values from config\n", got)
+	}
+
+	t.Setenv("TEST_REGION", "us")
+	assertExitCode(t, c, []string{"test", "scale", "--replicas", "5"}, 0)
+	if got[0] != "us" || got[1] != "5" {
+		t.Errorf("got %q want env and flag to take precedence over config\n", got)
+	}
+
+	c.SetConfigPaths(filepath.Join(dir, "invalid.json"), "$TEST_CONFIG_DIR/app.json")
+	assertExitCode(t, c, []string{"test", "scale"}, 1)
+
+	if p := DefaultConfigPaths("app"); len(p) != 3 || p[0] != "config.json" || p[2] != "/etc/app/config.json" {
+		t.Errorf("got %v want default search paths\n", p)
+	}
+}
+
+func TestRegexpReplacement(t *testing.T) {
+	var re []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("sed", "Replace", func(c *CLI) int {
+		p, repl := c.FlagRegexpReplacement("replace")
+		re = []string{p.String(), repl}
+		return 0
+	})
+	cmd.AddFlag("replace", "", "EXPR", "Replacement", TypeRegexpReplacement, nil)
+
+	for v, want := range map[string]string{
+		"/foo/bar/":       "foo bar",
+		"/fo(o+)/b$1/":    "fo(o+) b$1",
+		"|a/b|c|":         "a/b c",
+		`/a\/b/c\/d/`:     "a/b c/d",
+		`#\d+\.\d#[num]#`: `\d+\.\d [num]`,
+		"/^$//":           "^$ ",
+	} {
+		t.Run("parse replacement "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "sed", "--replace", v}, 0)
+			if strings.Join(re, " ") != want {
+				t.Errorf("got %q want %q\n", strings.Join(re, " "), want)
+			}
+		})
+	}
+	for _, v := range []string{"foo/bar/", "/foo/bar", "/foo/bar/baz/", "/fo(o/bar/", "/foo/", `\foo\bar\`, "afooabara"} {
+		t.Run("reject replacement "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "sed", "--replace", v}, 1)
+		})
+	}
+}
+
+func TestDeprecatedFlag(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("deploy", "Deploy", h)
+	cmd.AddFlag("old", "", "VAL", "Old", TypeString, nil).SetDeprecated("use --new instead", "v2.0")
+	cmd.AddFlag("legacy", "", "", "Legacy", TypeBool, nil).SetDeprecated("", "")
+	cmd.AddFlag("new", "", "VAL", "New", TypeString, nil)
+
+	for args, want := range map[string]string{
+		"--old x":  "WARNING: Flag --old is deprecated and it will be removed in v2.0: use --new instead\n",
+		"--legacy": "WARNING: Flag --legacy is deprecated\n",
+		"--new x":  "",
+	} {
+		t.Run("warn about "+args, func(t *testing.T) {
+			os.Args = append([]string{"test", "deploy"}, strings.Fields(args)...)
+			f, _ := os.CreateTemp(t.TempDir(), "stderr")
+			defer f.Close()
+			if code := c.Run(f, f); code != 0 {
+				t.Errorf("got %d want 0\n", code)
+			}
+			dat, _ := os.ReadFile(f.Name())
+			if string(dat) != want {
+				t.Errorf("got %q want %q\n", dat, want)
+			}
+		})
+	}
+
+	if depr, msg, v := cmd.GetFlag("old").Deprecation(); !depr || msg != "use --new instead" || v != "v2.0" {
+		t.Errorf("got %v %q %q want deprecation of --old\n", depr, msg, v)
+	}
+	if !strings.Contains(cmd.GetFlag("old").GetHelpLine(), "[deprecated, removed in v2.0]") {
+		t.Errorf("got %q want deprecation in help line\n", cmd.GetFlag("old").GetHelpLine())
+	}
+}
+
+func TestInterspersedFlags(t *testing.T) {
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("copy", "Copy", func(c *CLI) int {
+		got = append([]string{c.Flag("verbose"), c.Flag("mode")}, c.VariadicArg("files")...)
+		return 0
+	})
+	cmd.AddFlag("verbose", "v", "", "Verbose", TypeBool, nil)
+	cmd.AddFlag("mode", "m", "MODE", "Mode", TypeString, nil)
+	cmd.AddVariadicArg("files", "FILE", "Files", TypeString, 0, 0)
+
+	for args, want := range map[string]string{
+		"file1 --verbose file2":        "true  file1 file2",
+		"file1 -m fast file2 -v":       "true fast file1 file2",
+		"-v file1 -- --mode file2":     "true  file1 --mode file2",
+		"file1 -m -- file2 --verbose":  "true -- file1 file2",
+		"-- -v":                        "false  -v",
+		"file1 - file2 --mode=slow -v": "true slow file1 - file2",
+	} {
+		t.Run("parse "+args, func(t *testing.T) {
+			assertExitCode(t, c, append([]string{"test", "copy"}, strings.Fields(args)...), 0)
+			if strings.Join(got, " ") != want {
+				t.Errorf("got %q want %q\n", strings.Join(got, " "), want)
+			}
+		})
+	}
+
+	c.SetFlagsFirst(true)
+	assertExitCode(t, c, []string{"test", "copy", "-v", "file1", "--mode", "fast"}, 0)
+	if strings.Join(got, " ") != "true  file1 --mode fast" {
+		t.Errorf("got %q want flags after positional argument to be positional\n", strings.Join(got, " "))
+	}
+}
+
+func TestNonEmpty(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("tag", "Tag", h)
+	cmd.AddFlag("name", "n", "NAME", "Name", TypeNonEmpty, nil)
+	cmd.AddArg("label", "LABEL", "", TypeNonEmpty)
+
+	for _, args := range [][]string{{}, {"--name", "x"}, {"-n", " x "}, {"l"}} {
+		assertExitCode(t, c, append([]string{"test", "tag"}, args...), 0)
+	}
+	for _, args := range [][]string{{"--name", ""}, {"--name="}, {"-n", " \t"}, {""}, {"--name", "x", "  "}} {
+		assertExitCode(t, c, append([]string{"test", "tag"}, args...), 1)
+	}
+	if err := cmd.GetFlag("name").ValidateValue(false, "   ", ""); err == nil || err.Error() != "Flag name cannot be blank" {
+		t.Errorf("got %v want blank error\n", err)
+	}
+}
+
+func TestGeneratedHelpValue(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("send", "Send", h)
+	cmd.AddFlag("count", "c", "", "Count", TypeInt|Required, nil)
+	cmd.AddFlag("to", "", "", "Recipient", TypeEmail, nil)
+	cmd.AddFlag("attach", "", "ATTACHMENT", "Attachment", TypePathRegularFile, nil)
+	cmd.AddFlag("quiet", "q", "", "Quiet", TypeBool, nil)
+
+	for n, want := range map[string]string{"count": " --count <int> ", "to": " --to <email> ", "attach": " --attach ATTACHMENT ", "quiet": " --quiet \t"} {
+		if l := cmd.GetFlag(n).GetHelpLine(); !strings.Contains(l, want) {
+			t.Errorf("got %q want it to contain %q\n", l, want)
+		}
+	}
+	if u := cmd.Usage(); !strings.Contains(u, "--count <int> [--attach ATTACHMENT]") {
+		t.Errorf("got %q want generated help value in usage\n", u)
+	}
+}
+
+func TestIPMask(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("route", "Add route", h)
+	cmd.AddFlag("netmask", "", "MASK", "Netmask", TypeIPMask, nil)
+	cmd.AddFlag("netmasks", "", "MASKS", "Netmasks", TypeIPMask|AllowMany, nil)
+
+	for v, code := range map[string]int{
+		"255.255.255.0": 0, "255.255.255.255": 0, "0.0.0.0": 0, "255.255.240.0": 0, "128.0.0.0": 0,
+		"255.0.255.0": 1, "255.255.255.1": 1, "256.0.0.0": 1, "24": 1, "::ffff:255.255.255.0": 1, "ffff:ffff::": 1,
+	} {
+		t.Run("validate ip mask "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "route", "--netmask", v}, code)
+		})
+	}
+	assertExitCode(t, c, []string{"test", "route", "--netmasks", "255.255.255.0,255.255.0.0"}, 0)
+	assertExitCode(t, c, []string{"test", "route", "--netmasks", "255.255.255.0,255.0.255.0"}, 1)
+}
+
+func TestSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "db_password")
+	os.WriteFile(secret, []byte("s3cret\n"), 0600)
+	t.Setenv("TEST_DB_PASSWORD", "")
+
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("connect", "Connect", func(c *CLI) int {
+		got = []string{c.Flag("db-password"), c.cmd.Source("db-password"), c.Flag("token")}
+		return 0
+	})
+	pw := cmd.AddFlag("db-password", "", "PASSWORD", "Password", TypeString, nil)
+	pw.SetEnv("TEST_DB_PASSWORD")
+	pw.SetSecretFile(secret)
+	tok := cmd.AddFlag("token", "", "TOKEN", "Token", TypeString, nil)
+	tok.SetSecretFile(filepath.Join(dir, "missing"))
+
+	assertExitCode(t, c, []string{"test", "connect"}, 0)
+	if strings.Join(got, " ") != "s3cret secret-file " {
+		t.Errorf("got %q want value from secret file\n", got)
+	}
+	t.Setenv("TEST_DB_PASSWORD", "fromenv")
+	assertExitCode(t, c, []string{"test", "connect"}, 0)
+	if got[0] != "fromenv" {
+		t.Errorf("got %q want env to take precedence over secret file\n", got[0])
+	}
+	assertExitCode(t, c, []string{"test", "connect", "--db-password", "fromflag"}, 0)
+	if got[0] != "fromflag" {
+		t.Errorf("got %q want flag to take precedence over secret file\n", got[0])
+	}
+
+	if pw.nflags&Secret == 0 {
+		t.Errorf("got flag that is not Secret want Secret\n")
+	}
+	f := NewCLIFlag("api-key", "", "KEY", "Key", TypeString, nil)
+	f.SetSecretFile("")
+	if f.secFile != "/run/secrets/api-key" {
+		t.Errorf("got %q want default secret path\n", f.secFile)
+	}
+}
+
+func TestUUID(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("get", "Get", h)
+	cmd.AddFlag("id", "", "UUID", "ID", TypeUUID, nil)
+	cmd.AddFlag("request-id", "", "UUID", "Request ID", TypeUUID, nil).SetUUIDVersion(4)
+
+	v1, v4 := "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "9F3C2B1A-7D4E-4A6B-8C9D-0E1F2A3B4C5D"
+	for v, code := range map[string]int{v1: 0, v4: 0, "6ba7b8109dad11d180b400c04fd430c8": 1, "6ba7b810-9dad-11d1-80b4-00c04fd430cg": 1, "": 0} {
+		t.Run("validate uuid "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "get", "--id", v}, code)
+		})
+	}
+	assertExitCode(t, c, []string{"test", "get", "--request-id", v4}, 0)
+	assertExitCode(t, c, []string{"test", "get", "--request-id", "9f3c2b1a-7d4e-4a6b-cc9d-0e1f2a3b4c5d"}, 1)
+
+	err := cmd.GetFlag("request-id").ValidateValue(false, v1, "")
+	if err == nil || err.Error() != "Flag request-id must be a version 4 UUID but "+v1+" is version 1" {
+		t.Errorf("got %v want version error\n", err)
+	}
+}
+
+func TestExtraArgs(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	status := c.AddCmd("status", "Status", h)
+	c.AddCmd("show", "Show", h).AddArg("name", "NAME", "", TypeString)
+	c.AddCmd("rm", "Remove", h).AddVariadicArg("files", "FILE", "", TypeString, 0, 0)
+
+	assertExitCode(t, c, []string{"test", "status", "foo"}, 1)
+	assertExitCode(t, c, []string{"test", "show", "a"}, 0)
+	assertExitCode(t, c, []string{"test", "show", "a", "b"}, 1)
+	assertExitCode(t, c, []string{"test", "rm", "a", "b", "c"}, 0)
+
+	status.SetAllowExtraArgs(true)
+	assertExitCode(t, c, []string{"test", "status", "foo"}, 0)
+}
+
+func TestHelpAlignment(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("deploy", "Deploy", h)
+	cmd.AddFlag("environment", "e", "ENV", "Environment", TypeString|Required, nil)
+	cmd.AddFlag("v", "", "", "Verbose", TypeBool, nil)
+	cmd.AddFlag("message", "", "MSG", "Message that is written to the deployment log and shown in the history", TypeString, nil)
+
+	_, out := runWithOutput(t, c, []string{"test", "deploy", "--help"})
+	for _, want := range []string{
+		"  -e, --environment ENV  Environment\n",
+		"      --message MSG      Message that is written to the deployment log and shown in the history\n",
+		"      --v                Verbose\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("got %q want it to contain %q\n", out, want)
+		}
+	}
+
+	c.SetHelpWidth(50)
+	_, out = runWithOutput(t, c, []string{"test", "deploy", "--help"})
+	want := "      --message MSG      Message that is written\n" +
+		"                         to the deployment log and\n" +
+		"                         shown in the history\n"
+	if !strings.Contains(out, want) {
+		t.Errorf("got %q want it to contain %q\n", out, want)
+	}
+}
+
+func TestCmdReset(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(cfg, []byte(`{"a":1}`), 0644)
+
+	var got []string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("apply", "Apply", h)
+	cmd.AddFlag("verbose", "v", "", "Verbose", TypeBool|AllowDuplicate, nil)
+	cmd.AddFlag("config", "", "FILE", "Config", TypePathRegularFile|ValidJSON, nil)
+	cmd.AddFlag("name", "", "NAME", "Name", TypeString, nil)
+	cmd.AddArg("target", "TARGET", "", TypeString)
+	other := c.AddCmd("show", "Show", func(c *CLI) int {
+		got = []string{c.Flag("name"), c.Flag("config"), c.Arg("target")}
+		return 0
+	})
+	other.AddFlag("json", "", "", "JSON", TypeBool, nil)
+
+	assertExitCode(t, c, []string{"test", "apply", "-v", "-v", "--config", cfg, "--name", "x", "app"}, 0)
+	if cmd.Count("verbose") != 2 || cmd.Source("config") != "flag" || cmd.GetFlag("config").file.path != cfg {
+		t.Errorf("got %d %q want state of the parsing\n", cmd.Count("verbose"), cmd.Source("config"))
+	}
+	c.Reset()
+	if cmd.Count("verbose") != 0 || cmd.Source("config") != "" || cmd.GetFlag("config").file.dat != nil || c.Flag("name") != "" || c.Arg("target") != "" {
+		t.Errorf("got %d %q %q want state cleared\n", cmd.Count("verbose"), cmd.Source("config"), c.Flag("name"))
+	}
+
+	assertExitCode(t, c, []string{"test", "show"}, 0)
+	if strings.Join(got, "") != "" {
+		t.Errorf("got %q want no values of the previous run in handler\n", got)
+	}
+	assertExitCode(t, c, []string{"test", "apply", "-v"}, 0)
+	if cmd.Count("verbose") != 1 {
+		t.Errorf("got %d want 1 after reuse\n", cmd.Count("verbose"))
+	}
+}
+
+func TestHTTPHeader(t *testing.T) {
+	var got map[string][]string
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	cmd := c.AddCmd("get", "Get", func(c *CLI) int {
+		got = c.FlagHeaders("header")
+		return 0
+	})
+	cmd.AddFlag("header", "H", "HEADER", "Header", TypeHTTPHeader|AllowMany, nil)
+	one := c.AddCmd("auth", "Auth", h)
+	one.AddFlag("header", "H", "HEADER", "Header", TypeHTTPHeader, nil)
+
+	assertExitCode(t, c, []string{"test", "get", "-H", "Authorization: Bearer x", "-H", "Accept: text/html, application/json", "-H", "accept: */*"}, 0)
+	if strings.Join(got["Authorization"], "|") != "Bearer x" || strings.Join(got["Accept"], "|") != "text/html, application/json|*/*" {
+		t.Errorf("got %v want collected headers\n", got)
+	}
+
+	for v, code := range map[string]int{"X-Request-Id: 1": 0, "X-Empty:": 0, "X_Odd~Name!:v": 0, "Bad Name: v": 1, "NoColon": 1, ": v": 1, "X(y): v": 1, "X: a\x01b": 1} {
+		t.Run("validate header "+v, func(t *testing.T) {
+			assertExitCode(t, c, []string{"test", "auth", "-H", v}, code)
+		})
+	}
+	assertExitCode(t, c, []string{"test", "auth", "-H", "A: 1", "-H", "B: 2"}, 1)
+}
+
+func TestHelpTemplate(t *testing.T) {
+	c := NewCLI("Example CLI", "Silly app", "Author <a@example.com>")
+	deploy := c.AddCmd("deploy", "Deploy the app", h)
+	deploy.AddFlag("env", "e", "ENV", "Environment", TypeString|Required, nil)
+	deploy.AddFlag("dry-run", "", "", "Dry run", TypeBool, nil)
+	status := c.AddCmd("status", "Show status", h)
+	status.AddFlag("json", "", "", "Print JSON", TypeBool, nil)
+
+	c.SetHelpTemplate("{{.Name}}: {{.Description}}\n{{range .OptionalFlags}}[--{{.Name}}]\n{{end}}")
+	deploy.SetHelpTemplate("{{.Usage}}\n{{range .RequiredFlags}}{{.Alias}} {{.Name}} {{.Value}} ({{.Description}})\n{{end}}{{range .OptionalFlags}}{{.Line}}\n{{end}}")
+
+	_, out := runWithOutput(t, c, []string{"test", "deploy", "--help"})
+	want := "Usage:  test deploy --env ENV [--dry-run]\ne env ENV (Environment)\n      --dry-run  Dry run\n"
+	if out != want {
+		t.Errorf("got %q want %q\n", out, want)
+	}
+	_, out = runWithOutput(t, c, []string{"test", "help", "status"})
+	if out != "status: Show status\n[--json]\n" {
+		t.Errorf("got %q want help from CLI template\n", out)
+	}
 }
@@ -42,7 +42,9 @@ available:
     * TypeString - flag is a string;
     * TypeBool - flag is boolean and will have a value of "true" or "false".
 
-Check cli_flag.go for more information on flag types.
+Check cli_flag.go for more information on flag types. Flags that are not
+Required are validated only when they are passed, so an empty optional flag
+of any type is valid.
 
 Finally, let's create functions to handle our commands. In below code, you can
 see that method Flag on CLI instance (passed as first argument) can be